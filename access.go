@@ -0,0 +1,69 @@
+package intintmap
+
+// WithAccessTracking makes the map count the successful Get and GetPtr
+// calls for every key, readable with Accesses. It costs an extra uint64 per
+// slot, which moves with its entry when the map rehashes or shifts entries
+// on deletion, and an increment per successful lookup. Overwriting a key
+// keeps its count; a newly inserted key starts at 0. Lookups made by the
+// map's own operations, such as Rename, are not counted.
+//
+// Since every Get and GetPtr then writes to the map, a tracked map needs
+// exclusive access even for reads: concurrent readers, e.g. under the read
+// lock of a sync.RWMutex, race with each other.
+func WithAccessTracking() Option {
+	return func(m *Map) {
+		m.hooked = true
+		m.counted = true
+		m.slow = true
+		m.hits = make([]uint64, len(m.data)/2)
+	}
+}
+
+// Accesses returns the number of successful lookups of key in a map created
+// with WithAccessTracking; ok is false if key is absent. It does not count
+// as an access itself.
+func (m *Map) Accesses(key uint64) (n uint64, ok bool) {
+	if !m.counted {
+		panic("Accesses requires WithAccessTracking")
+	}
+	if key == FREE_KEY {
+		return m.freeHits, m.hasFreeKey
+	}
+	if ptr, ok := m.lookup(key); ok {
+		return m.hits[ptr>>1], true
+	}
+	return 0, false
+}
+
+// SplitHotCold partitions the entries of a map created with
+// WithAccessTracking into a new map of those looked up at least minAccesses
+// times and a new map of the rest, both holding the original values and
+// using m's fill factor. The free key is placed by its own access count. m
+// is left unchanged and splitting does not count as an access. It panics if
+// the map was not created with WithAccessTracking.
+func (m *Map) SplitHotCold(minAccesses uint64) (hot, cold *Map) {
+	if !m.counted {
+		panic("SplitHotCold requires WithAccessTracking")
+	}
+	hot, cold = m.newSized(1), m.newSized(1)
+
+	if m.hasFreeKey {
+		if m.freeHits >= minAccesses {
+			hot.Put(FREE_KEY, m.freeVal)
+		} else {
+			cold.Put(FREE_KEY, m.freeVal)
+		}
+	}
+	data := m.data
+	for i := 0; i < len(data); i += 2 {
+		if data[i] == FREE_KEY {
+			continue
+		}
+		if m.hits[i>>1] >= minAccesses {
+			hot.Put(data[i], data[i+1])
+		} else {
+			cold.Put(data[i], data[i+1])
+		}
+	}
+	return hot, cold
+}
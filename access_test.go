@@ -0,0 +1,90 @@
+package intintmap
+
+import (
+	"testing"
+)
+
+func TestSplitHotCold(t *testing.T) {
+	m := New(10, 0.6, WithAccessTracking())
+	var i uint64
+	for i = 0; i < 1000; i++ {
+		m.Put(i, i*2)
+	}
+	for i = 0; i < 1000; i += 10 {
+		m.Get(i)
+		m.Get(i)
+		m.GetPtr(i)
+	}
+	m.Put(10, 5) // overwriting keeps the count
+	m.Del(20)
+	m.Put(20, 40)                 // reinserting starts over
+	for i = 1000; i < 3000; i++ { // rehash and shift entries
+		m.Put(i, i)
+	}
+	for i = 1000; i < 3000; i++ {
+		m.Del(i)
+	}
+
+	if n, ok := m.Accesses(30); !ok || n != 3 {
+		t.Errorf("expected 3 accesses of key 30, got %d", n)
+	}
+	hot, cold := m.SplitHotCold(3)
+	if hot.Size() != 99 || cold.Size() != 901 {
+		t.Errorf("got %d hot and %d cold entries, expected 99 and 901", hot.Size(), cold.Size())
+	}
+	if _, ok := hot.Get(0); !ok {
+		t.Errorf("expected the free key to be hot")
+	}
+	if v, ok := hot.Get(10); !ok || v != 5 {
+		t.Errorf("expected 5 as hot value for key 10, got %d", v)
+	}
+	if _, ok := cold.Get(20); !ok {
+		t.Errorf("expected reinserted key 20 to be cold")
+	}
+	if n, _ := m.Accesses(30); n != 3 {
+		t.Errorf("didn't expect splitting to count as access")
+	}
+}
+
+func TestAccessesIgnoreInternalLookups(t *testing.T) {
+	m := New(10, 0.6, WithAccessTracking())
+	var i uint64
+	for i = 0; i < 100; i++ {
+		m.Put(i, i)
+	}
+	other := New(10, 0.6)
+	other.Put(1, 5)
+	other.Put(2, 2)
+
+	m.Rename(1, 1)
+	m.Rename(2, 3) // refused, 3 is present
+	m.MergeDetectingConflicts(other)
+	m.MergeTrackingNew(other)
+
+	// Read-only combinators, with the tracked maps on either side.
+	tracked := New(10, 0.6, WithAccessTracking())
+	tracked.Put(1, 1)
+	tracked.Put(2, 2)
+	pair := func(_, a, b uint64) uint64 { return a + b }
+	for _, ab := range [][2]*Map{{m, tracked}, {tracked, m}} {
+		a, b := ab[0], ab[1]
+		DeltaMap(a, b)
+		CommonKeys(a, b)
+		SignificantChanges(a, b, 1)
+		CoIterate(a, b, func(uint64, uint64, bool, uint64, bool) bool { return true })
+		Join(a, b, pair)
+		LeftJoin(a, b, 0, pair)
+		a.PatchTo(b)
+	}
+	m.LWWMerge(other, tracked, tracked)
+	for i = 1; i < 3; i++ {
+		if n, ok := tracked.Accesses(i); !ok || n != 0 {
+			t.Errorf("expected 0 accesses of key %d, got %d", i, n)
+		}
+	}
+	for i = 0; i < 4; i++ {
+		if n, ok := m.Accesses(i); !ok || n != 0 {
+			t.Errorf("expected 0 accesses of key %d, got %d", i, n)
+		}
+	}
+}
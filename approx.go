@@ -0,0 +1,138 @@
+package intintmap
+
+import (
+	"math"
+	"math/bits"
+)
+
+// ApproxCounter is a count-min sketch: a frequency estimator for key spaces
+// too large to count exactly. It keeps depth rows of width counters, each row
+// a Map from column to count, and every key is counted in one column per row
+// chosen by an independently seeded hash.
+//
+// Estimates never undercount. With N the total of all deltas added, an
+// estimate exceeds the true count by more than e/width * N with probability
+// at most e^-depth, so width = ceil(e/ε) and depth = ceil(ln(1/δ)) bound the
+// error by εN with probability 1-δ, using width*depth counters.
+type ApproxCounter struct {
+	width uint64
+	rows  []*Map
+}
+
+// NewApproxCounter returns an empty sketch of depth rows of width counters.
+func NewApproxCounter(width, depth int) *ApproxCounter {
+	if width <= 0 || depth <= 0 {
+		panic("Width and depth must be positive")
+	}
+	c := &ApproxCounter{width: uint64(width), rows: make([]*Map, depth)}
+	for i := range c.rows {
+		c.rows[i] = New(width, 0.6)
+	}
+	return c
+}
+
+// column returns the counter of key in row i.
+func (c *ApproxCounter) column(key uint64, i int) uint64 {
+	return pairHash(key, uint64(i)) % c.width
+}
+
+// Add adds delta to the count of key.
+func (c *ApproxCounter) Add(key, delta uint64) {
+	for i, row := range c.rows {
+		col := c.column(key, i)
+		v, _ := row.Get(col)
+		row.Put(col, v+delta)
+	}
+}
+
+// Estimate returns an upper bound on the count of key: the minimum of its
+// counters across rows.
+func (c *ApproxCounter) Estimate(key uint64) uint64 {
+	est := ^uint64(0)
+	for i, row := range c.rows {
+		if v, _ := row.Get(c.column(key, i)); v < est {
+			est = v
+		}
+	}
+	return est
+}
+
+// ApproxCardinality is a HyperLogLog sketch: it estimates the number of
+// distinct keys added using one byte for each of its 2^precision registers.
+// The relative standard error of an estimate is about 1.04/sqrt(2^precision),
+// e.g. 1.6% for precision 12 (4 KiB) and 0.8% for precision 14 (16 KiB).
+//
+// Keys are hashed with pairHash rather than phiMix: phiMix only has to spread
+// keys over table slots, and for runs of nearby keys its bits are too regular
+// for the leading-zero counts HyperLogLog relies on.
+type ApproxCardinality struct {
+	precision uint
+	regs      []uint8
+}
+
+// NewApproxCardinality returns an empty sketch of 2^precision registers;
+// precision must be in [4, 16].
+func NewApproxCardinality(precision int) *ApproxCardinality {
+	if precision < 4 || precision > 16 {
+		panic("Precision must be in [4, 16]")
+	}
+	return &ApproxCardinality{
+		precision: uint(precision),
+		regs:      make([]uint8, 1<<precision),
+	}
+}
+
+// Add records key. Adding a key again doesn't change the estimate.
+func (c *ApproxCardinality) Add(key uint64) {
+	h := pairHash(key, 0)
+	reg := h >> (64 - c.precision)
+	rank := uint8(bits.LeadingZeros64(h<<c.precision|1<<(c.precision-1))) + 1
+	if rank > c.regs[reg] {
+		c.regs[reg] = rank
+	}
+}
+
+// Estimate returns the estimated number of distinct keys added, using linear
+// counting while many registers are still empty.
+func (c *ApproxCardinality) Estimate() uint64 {
+	m := float64(len(c.regs))
+	var sum float64
+	zeros := 0
+	for _, r := range c.regs {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	var alpha float64
+	switch len(c.regs) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	default:
+		alpha = 0.7213 / (1 + 1.079/m)
+	}
+	est := alpha * m * m / sum
+	if est <= 2.5*m && zeros > 0 {
+		est = m * math.Log(m/float64(zeros))
+	}
+	return uint64(est + 0.5)
+}
+
+// Merge folds other into c, so c estimates the distinct keys added to
+// either, e.g. to combine per-shard sketches. Both must have the same
+// precision.
+func (c *ApproxCardinality) Merge(other *ApproxCardinality) {
+	if other.precision != c.precision {
+		panic("Precisions must match")
+	}
+	for i, r := range other.regs {
+		if r > c.regs[i] {
+			c.regs[i] = r
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package intintmap
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestApproxCounter(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	c := NewApproxCounter(272, 5) // ε = 0.01, δ ≈ 0.007
+	exact := map[uint64]uint64{}
+	var total uint64
+	for i := 0; i < 20000; i++ {
+		k := uint64(rng.Intn(5000))
+		d := uint64(rng.Intn(10) + 1)
+		c.Add(k, d)
+		exact[k] += d
+		total += d
+	}
+
+	over := 0
+	for k, n := range exact {
+		est := c.Estimate(k)
+		if est < n {
+			t.Errorf("estimate %d for key %d undercounts %d", est, k, n)
+		}
+		if est-n > total/100 {
+			over++
+		}
+	}
+	if over > len(exact)/50 {
+		t.Errorf("%d of %d estimates exceed the error bound", over, len(exact))
+	}
+	if est := c.Estimate(1 << 40); est > total/100 {
+		t.Errorf("estimate %d for an unseen key exceeds the error bound", est)
+	}
+}
+
+func TestApproxCardinality(t *testing.T) {
+	within := func(est, n uint64, tol float64) bool {
+		return math.Abs(float64(est)-float64(n)) <= tol*float64(n)
+	}
+
+	c := NewApproxCardinality(14) // standard error 0.8%
+	if est := c.Estimate(); est != 0 {
+		t.Errorf("estimate %d for an empty sketch, expected 0", est)
+	}
+	var i uint64
+	for i = 1; i <= 100; i++ {
+		c.Add(i)
+	}
+	if est := c.Estimate(); !within(est, 100, 0.05) {
+		t.Errorf("estimate %d for 100 keys", est)
+	}
+
+	a, b := NewApproxCardinality(14), NewApproxCardinality(14)
+	for i = 0; i < 200000; i++ {
+		if i < 120000 {
+			a.Add(i)
+			a.Add(i) // duplicates don't count
+		}
+		if i >= 80000 {
+			b.Add(i)
+		}
+	}
+	if est := a.Estimate(); !within(est, 120000, 0.03) {
+		t.Errorf("estimate %d for 120000 keys", est)
+	}
+	a.Merge(b)
+	if est := a.Estimate(); !within(est, 200000, 0.03) {
+		t.Errorf("estimate %d for 200000 merged keys", est)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for mismatched precisions")
+		}
+	}()
+	a.Merge(NewApproxCardinality(12))
+}
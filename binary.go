@@ -0,0 +1,265 @@
+package intintmap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// The binary format is a fixed header followed by the entries as key-value
+// pairs, all little-endian:
+//
+//	magic      [4]byte "IIMP"
+//	version    uint32
+//	fillFactor float64 (IEEE 754 bits)
+//	count      uint64
+//	entries    count * (key uint64, value uint64), sorted by key
+const (
+	binaryMagic      = "IIMP"
+	binaryVersion    = 1
+	binaryHeaderSize = 24
+	binaryPairSize   = 16
+)
+
+// sortedItems returns all key-value pairs in ascending key order.
+func (m *Map) sortedItems() [][2]uint64 {
+	items := make([][2]uint64, 0, m.Size())
+	m.each(func(k, v uint64) bool {
+		items = append(items, [2]uint64{k, v})
+		return true
+	})
+	sort.Slice(items, func(i, j int) bool { return items[i][0] < items[j][0] })
+	return items
+}
+
+// MarshalSize returns the exact length of the output of MarshalBinary: the
+// header plus one key-value pair per entry, the free key included.
+func (m *Map) MarshalSize() int {
+	return binaryHeaderSize + m.Size()*binaryPairSize
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler. Entries are written in
+// ascending key order regardless of the internal layout, so maps with the
+// same contents and fill factor always encode to identical bytes.
+func (m *Map) MarshalBinary() ([]byte, error) {
+	items := m.sortedItems()
+
+	buf := make([]byte, m.MarshalSize())
+	copy(buf, binaryMagic)
+	binary.LittleEndian.PutUint32(buf[4:], binaryVersion)
+	binary.LittleEndian.PutUint64(buf[8:], math.Float64bits(m.fillFactor))
+	binary.LittleEndian.PutUint64(buf[16:], uint64(len(items)))
+
+	p := buf[binaryHeaderSize:]
+	for _, kv := range items {
+		binary.LittleEndian.PutUint64(p, kv[0])
+		binary.LittleEndian.PutUint64(p[8:], kv[1])
+		p = p[binaryPairSize:]
+	}
+	return buf, nil
+}
+
+// ValidateBinary checks that data is well-formed MarshalBinary output, its
+// magic, version, fill factor and entry count consistent with its length,
+// without decoding the entries or allocating, so untrusted payloads can be
+// rejected before committing memory to them. It doesn't detect corrupted
+// keys or values, which the format carries no checksum for.
+func ValidateBinary(data []byte) error {
+	if len(data) < binaryHeaderSize {
+		return errors.New("intintmap: binary data too short for header")
+	}
+	if string(data[:4]) != binaryMagic {
+		return errors.New("intintmap: invalid binary magic")
+	}
+	if v := binary.LittleEndian.Uint32(data[4:]); v != binaryVersion {
+		return fmt.Errorf("intintmap: unsupported binary version %d", v)
+	}
+	fillFactor := math.Float64frombits(binary.LittleEndian.Uint64(data[8:]))
+	if !(fillFactor > 0 && fillFactor < 1) {
+		return fmt.Errorf("intintmap: invalid fill factor %v", fillFactor)
+	}
+	count := binary.LittleEndian.Uint64(data[16:])
+	if count != uint64(len(data)-binaryHeaderSize)/binaryPairSize ||
+		(len(data)-binaryHeaderSize)%binaryPairSize != 0 {
+		return fmt.Errorf("intintmap: entry count %d does not match %d bytes of data", count, len(data))
+	}
+	return nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler. It replaces the
+// contents of m with the decoded entries, using the encoded fill factor.
+// The map's options and Meta are kept; Meta is never serialized.
+func (m *Map) UnmarshalBinary(data []byte) error {
+	if err := ValidateBinary(data); err != nil {
+		return err
+	}
+	fillFactor := math.Float64frombits(binary.LittleEndian.Uint64(data[8:]))
+	count := binary.LittleEndian.Uint64(data[16:])
+
+	n := New(int(count)+1, fillFactor, m.opts...)
+	p := data[binaryHeaderSize:]
+	for i := uint64(0); i < count; i++ {
+		n.Put(binary.LittleEndian.Uint64(p), binary.LittleEndian.Uint64(p[8:]))
+		p = p[binaryPairSize:]
+	}
+	n.meta = m.meta
+	*m = *n
+	return nil
+}
+
+// The fixed-width format written by MarshalFixed is a 16-byte header
+// followed by one 16-byte record per entry, all little-endian, so a reader
+// can mmap the file and binary-search the records in place:
+//
+//	magic   [4]byte "IIMF"
+//	version uint32
+//	count   uint64
+//	records count * (key uint64, value uint64), sorted by key
+const (
+	fixedMagic      = "IIMF"
+	fixedVersion    = 1
+	fixedHeaderSize = 16
+)
+
+// MarshalFixed writes the map to w in the fixed-width format, the free key
+// included as the first record when present.
+func (m *Map) MarshalFixed(w io.Writer) error {
+	items := m.sortedItems()
+
+	var header [fixedHeaderSize]byte
+	copy(header[:], fixedMagic)
+	binary.LittleEndian.PutUint32(header[4:], fixedVersion)
+	binary.LittleEndian.PutUint64(header[8:], uint64(len(items)))
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 0, 256*binaryPairSize)
+	for i, kv := range items {
+		buf = binary.LittleEndian.AppendUint64(buf, kv[0])
+		buf = binary.LittleEndian.AppendUint64(buf, kv[1])
+		if len(buf) == cap(buf) || i == len(items)-1 {
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+			buf = buf[:0]
+		}
+	}
+	return nil
+}
+
+// MarshalChunk writes part of the MarshalBinary encoding of the map to w, at
+// most maxBytes, which must be at least 40, and returns the cursor to pass
+// to the next call, or 0 once everything is written. Start with cursor 0,
+// which writes the header and the free key before the first table entries;
+// other cursor values are opaque. Concatenating all chunks yields a buffer
+// UnmarshalBinary accepts, though entries appear in table order rather than
+// sorted. The map must not change between calls; to checkpoint a map that
+// keeps changing, marshal a Clone.
+func (m *Map) MarshalChunk(w io.Writer, cursor int, maxBytes int) (nextCursor int, err error) {
+	if maxBytes < binaryHeaderSize+binaryPairSize {
+		panic("MaxBytes must be at least 40")
+	}
+
+	buf := make([]byte, 0, maxBytes)
+	slot := 0
+	if cursor == 0 {
+		buf = append(buf, binaryMagic...)
+		buf = binary.LittleEndian.AppendUint32(buf, binaryVersion)
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(m.fillFactor))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(m.Size()))
+		if m.hasFreeKey {
+			buf = binary.LittleEndian.AppendUint64(buf, FREE_KEY)
+			buf = binary.LittleEndian.AppendUint64(buf, m.freeVal)
+		}
+	} else {
+		slot = cursor - 1 // cursors are slot indexes plus one
+	}
+
+	data := m.data
+	for ; 2*slot < len(data); slot++ {
+		if data[2*slot] == FREE_KEY {
+			continue
+		}
+		if len(buf)+binaryPairSize > maxBytes {
+			break
+		}
+		buf = binary.LittleEndian.AppendUint64(buf, data[2*slot])
+		buf = binary.LittleEndian.AppendUint64(buf, data[2*slot+1])
+	}
+	if _, err = w.Write(buf); err != nil {
+		return cursor, err
+	}
+	if 2*slot >= len(data) {
+		return 0, nil
+	}
+	return slot + 1, nil
+}
+
+// WriteColumnar writes the keys of the map to keysW and the values to valsW
+// as little-endian uint64s without any header, entry i of one stream
+// matching entry i of the other. The free key, when present, is the first
+// entry of both; the rest follow in table order. Separate columns compress
+// better than interleaved pairs and load directly into columnar tools.
+func (m *Map) WriteColumnar(keysW, valsW io.Writer) error {
+	keys := make([]byte, 0, 256*8)
+	vals := make([]byte, 0, 256*8)
+	flush := func() error {
+		if _, err := keysW.Write(keys); err != nil {
+			return err
+		}
+		if _, err := valsW.Write(vals); err != nil {
+			return err
+		}
+		keys, vals = keys[:0], vals[:0]
+		return nil
+	}
+
+	var err error
+	m.each(func(k, v uint64) bool {
+		keys = binary.LittleEndian.AppendUint64(keys, k)
+		vals = binary.LittleEndian.AppendUint64(vals, v)
+		if len(keys) == cap(keys) {
+			err = flush()
+		}
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// ReadColumnar returns a map built from the key and value streams written
+// by WriteColumnar, with the given fill factor; a key repeated in the
+// streams takes its last value. It returns an error if the streams hold
+// different numbers of entries or end within an entry.
+func ReadColumnar(keysR, valsR io.Reader, fillFactor float64) (*Map, error) {
+	if !(fillFactor > 0 && fillFactor < 1) {
+		return nil, fmt.Errorf("intintmap: invalid fill factor %v", fillFactor)
+	}
+	kr, vr := bufio.NewReader(keysR), bufio.NewReader(valsR)
+	m := New(1, fillFactor)
+	var kb, vb [8]byte
+	for n := 0; ; n++ {
+		_, kerr := io.ReadFull(kr, kb[:])
+		_, verr := io.ReadFull(vr, vb[:])
+		switch {
+		case kerr == io.EOF && verr == io.EOF:
+			return m, nil
+		case kerr == io.EOF && (verr == nil || verr == io.ErrUnexpectedEOF):
+			return nil, fmt.Errorf("intintmap: value column longer than %d key column entries", n)
+		case verr == io.EOF && (kerr == nil || kerr == io.ErrUnexpectedEOF):
+			return nil, fmt.Errorf("intintmap: key column longer than %d value column entries", n)
+		case kerr != nil:
+			return nil, fmt.Errorf("intintmap: reading key column entry %d: %w", n, kerr)
+		case verr != nil:
+			return nil, fmt.Errorf("intintmap: reading value column entry %d: %w", n, verr)
+		}
+		m.Put(binary.LittleEndian.Uint64(kb[:]), binary.LittleEndian.Uint64(vb[:]))
+	}
+}
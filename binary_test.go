@@ -0,0 +1,226 @@
+package intintmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestMarshalBinary(t *testing.T) {
+	var i uint64
+
+	// Same contents, different histories and capacities.
+	a := New(10, 0.6)
+	for i = 0; i < 1000; i++ {
+		a.Put(i*7, i)
+	}
+	b := New(4000, 0.6)
+	for i = 1 << 40; i < 1<<40+3000; i++ {
+		b.Put(i, i)
+	}
+	for i = 1000; i > 0; i-- {
+		b.Put((i-1)*7, i-1)
+	}
+	for i = 1 << 40; i < 1<<40+3000; i++ {
+		b.Del(i)
+	}
+
+	ab, err := a.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bb, err := b.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ab, bb) {
+		t.Errorf("content-identical maps serialized differently")
+	}
+
+	var c Map
+	if err = c.UnmarshalBinary(ab); err != nil {
+		t.Fatal(err)
+	}
+	if c.Size() != a.Size() {
+		t.Errorf("size (%d) is not right, should be %d", c.Size(), a.Size())
+	}
+	for i = 0; i < 1000; i++ {
+		if v, ok := c.Get(i * 7); !ok || v != i {
+			t.Errorf("expected %d as value for key %d, got %d", i, i*7, v)
+		}
+	}
+
+	if err = c.UnmarshalBinary(ab[:len(ab)-1]); err == nil {
+		t.Errorf("expected an error for truncated data")
+	}
+}
+
+func TestMarshalSize(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 100; i++ {
+		m.Put(i, i)
+		b, _ := m.MarshalBinary()
+		if m.MarshalSize() != len(b) {
+			t.Errorf("MarshalSize (%d) is not right, should be %d", m.MarshalSize(), len(b))
+		}
+	}
+}
+
+func TestValidateBinary(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 100; i++ {
+		m.Put(i, i)
+	}
+	good, _ := m.MarshalBinary()
+	if err := ValidateBinary(good); err != nil {
+		t.Errorf("valid data rejected: %v", err)
+	}
+
+	tamper := func(fn func(b []byte)) []byte {
+		b := append([]byte(nil), good...)
+		fn(b)
+		return b
+	}
+	bad := map[string][]byte{
+		"empty":            nil,
+		"truncated header": good[:binaryHeaderSize-1],
+		"truncated entry":  good[:len(good)-1],
+		"missing entry":    good[:len(good)-binaryPairSize],
+		"extra bytes":      append(append([]byte(nil), good...), 0),
+		"magic":            tamper(func(b []byte) { b[0] = 'X' }),
+		"version":          tamper(func(b []byte) { binary.LittleEndian.PutUint32(b[4:], 2) }),
+		"fill factor":      tamper(func(b []byte) { binary.LittleEndian.PutUint64(b[8:], 0) }),
+		"huge count":       tamper(func(b []byte) { binary.LittleEndian.PutUint64(b[16:], 1<<62) }),
+	}
+	for name, b := range bad {
+		if err := ValidateBinary(b); err == nil {
+			t.Errorf("expected an error for %s", name)
+		}
+		var c Map
+		if err := c.UnmarshalBinary(b); err == nil {
+			t.Errorf("expected UnmarshalBinary to reject %s", name)
+		}
+	}
+}
+
+func TestMarshalFixed(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 1000; i++ {
+		m.Put(1000-i, i)
+	}
+
+	var buf bytes.Buffer
+	if err := m.MarshalFixed(&buf); err != nil {
+		t.Fatal(err)
+	}
+	b := buf.Bytes()
+	if len(b) != 16+16*1000 || string(b[:4]) != "IIMF" {
+		t.Fatalf("unexpected header or length %d", len(b))
+	}
+	if n := binary.LittleEndian.Uint64(b[8:]); n != 1000 {
+		t.Errorf("record count (%d) is not right, should be 1000", n)
+	}
+	for r := 0; r < 1000; r++ {
+		k := binary.LittleEndian.Uint64(b[16+16*r:])
+		v := binary.LittleEndian.Uint64(b[24+16*r:])
+		if k != uint64(r+1) || v != 1000-k {
+			t.Errorf("unexpected record %d: key %d, value %d", r, k, v)
+		}
+	}
+}
+
+func TestMarshalChunk(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 1000; i++ {
+		m.Put(i*3, i)
+	}
+
+	var buf bytes.Buffer
+	chunks, cursor := 0, 0
+	for {
+		n := buf.Len()
+		var err error
+		if cursor, err = m.MarshalChunk(&buf, cursor, 100); err != nil {
+			t.Fatal(err)
+		}
+		chunks++
+		if buf.Len()-n > 100 {
+			t.Errorf("chunk of %d bytes exceeds the limit", buf.Len()-n)
+		}
+		if cursor == 0 {
+			break
+		}
+	}
+	if chunks < 100 {
+		t.Errorf("expected the encoding to be split into many chunks, got %d", chunks)
+	}
+	if buf.Len() != m.MarshalSize() {
+		t.Errorf("chunks hold %d bytes, expected %d", buf.Len(), m.MarshalSize())
+	}
+
+	var c Map
+	if err := c.UnmarshalBinary(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if c.Size() != m.Size() || c.Checksum() != m.Checksum() {
+		t.Errorf("reassembled map differs from the original")
+	}
+}
+
+func TestColumnar(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 1000; i++ {
+		m.Put(i*5, i)
+	}
+
+	var keys, vals bytes.Buffer
+	if err := m.WriteColumnar(&keys, &vals); err != nil {
+		t.Fatal(err)
+	}
+	if keys.Len() != 8*1000 || vals.Len() != 8*1000 {
+		t.Fatalf("unexpected column lengths %d and %d", keys.Len(), vals.Len())
+	}
+	if k := binary.LittleEndian.Uint64(keys.Bytes()); k != 0 {
+		t.Errorf("expected the free key first, got %d", k)
+	}
+	kb, vb := keys.Bytes(), vals.Bytes()
+
+	c, err := ReadColumnar(bytes.NewReader(kb), bytes.NewReader(vb), 0.6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Size() != m.Size() || c.Checksum() != m.Checksum() {
+		t.Errorf("columnar round trip changed the contents")
+	}
+
+	bad := map[string][2][]byte{
+		"short values":    {kb, vb[:len(vb)-8]},
+		"short keys":      {kb[:len(kb)-8], vb},
+		"truncated key":   {kb[:len(kb)-3], vb},
+		"truncated value": {kb, vb[:len(vb)-3]},
+	}
+	for name, cols := range bad {
+		if _, err := ReadColumnar(bytes.NewReader(cols[0]), bytes.NewReader(cols[1]), 0.6); err == nil {
+			t.Errorf("expected an error for %s", name)
+		}
+	}
+
+	// A column ending where the other one breaks off within an entry has
+	// more entries, however short its last one.
+	mismatched := map[string][2][]byte{
+		"short keys, truncated value": {kb[:len(kb)-8], vb[:len(vb)-3]},
+		"short values, truncated key": {kb[:len(kb)-3], vb[:len(vb)-8]},
+	}
+	for name, cols := range mismatched {
+		_, err := ReadColumnar(bytes.NewReader(cols[0]), bytes.NewReader(cols[1]), 0.6)
+		if err == nil || !strings.Contains(err.Error(), "column longer than") {
+			t.Errorf("expected a column length mismatch for %s, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package intintmap
+
+// CacheMap is a read-through cache: a Map in front of a loader that is
+// consulted on misses. Like Map it is not safe for concurrent use; callers
+// sharing one between goroutines must guard it with a mutex, which also
+// serializes calls to the loader.
+type CacheMap struct {
+	m      *Map
+	loader func(key uint64) (uint64, bool)
+}
+
+// NewCacheMap returns an empty cache over loader, whose map is created with
+// New(size, fillFactor).
+func NewCacheMap(size int, fillFactor float64, loader func(key uint64) (uint64, bool)) *CacheMap {
+	return &CacheMap{m: New(size, fillFactor), loader: loader}
+}
+
+// Get returns the cached value of key, calling the loader on a miss and
+// caching what it returns. When the loader reports false nothing is cached,
+// so the next Get of key calls the loader again.
+func (c *CacheMap) Get(key uint64) (uint64, bool) {
+	if v, ok := c.m.Get(key); ok {
+		return v, true
+	}
+	v, ok := c.loader(key)
+	if ok {
+		c.m.Put(key, v)
+	}
+	return v, ok
+}
+
+// Invalidate removes key from the cache so the next Get reloads it.
+func (c *CacheMap) Invalidate(key uint64) {
+	c.m.Del(key)
+}
+
+// Map returns the underlying map of cached entries.
+func (c *CacheMap) Map() *Map {
+	return c.m
+}
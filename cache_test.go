@@ -0,0 +1,34 @@
+package intintmap
+
+import (
+	"testing"
+)
+
+func TestCacheMap(t *testing.T) {
+	calls := 0
+	c := NewCacheMap(10, 0.6, func(key uint64) (uint64, bool) {
+		calls++
+		return key * 2, key%2 == 0
+	})
+
+	for i := 0; i < 3; i++ {
+		if v, ok := c.Get(4); !ok || v != 8 {
+			t.Errorf("expected 8 as value for key 4, got %d", v)
+		}
+		if _, ok := c.Get(3); ok {
+			t.Errorf("didn't expect a value for key 3")
+		}
+	}
+	if calls != 4 {
+		t.Errorf("loader called %d times, expected 4", calls)
+	}
+	if c.Map().Size() != 1 {
+		t.Errorf("expected misses not to be cached")
+	}
+
+	c.Invalidate(4)
+	c.Get(4)
+	if calls != 5 {
+		t.Errorf("expected Invalidate to force a reload")
+	}
+}
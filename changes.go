@@ -0,0 +1,92 @@
+package intintmap
+
+import (
+	"sort"
+)
+
+// WithChangeTracking makes the map stamp every insert and update with a
+// version number so ChangesSince can report them, and log every deletion for
+// DeletedSince. It costs an extra uint64 per slot, which moves with its
+// entry when the map rehashes or shifts entries on deletion, and 16 bytes
+// per deletion until TrimChanges discards it.
+func WithChangeTracking() Option {
+	return func(m *Map) {
+		m.hooked = true
+		m.tracked = true
+		m.seqs = make([]uint64, len(m.data)/2)
+	}
+}
+
+// Version returns the number of changes made to a map created with
+// WithChangeTracking, to be passed to a later ChangesSince. Every Put, Del
+// and other mutation increments it.
+func (m *Map) Version() uint64 {
+	return m.version
+}
+
+// ChangesSince returns the entries, the free key included, inserted or
+// updated after Version() returned version, in unspecified order. Keys
+// deleted since are reported by DeletedSince; a replica applying both
+// results catches up with the map. It panics if the map was not created
+// with WithChangeTracking.
+func (m *Map) ChangesSince(version uint64) [][2]uint64 {
+	if !m.tracked {
+		panic("ChangesSince requires WithChangeTracking")
+	}
+	var changes [][2]uint64
+	if m.hasFreeKey && m.freeSeq > version {
+		changes = append(changes, [2]uint64{FREE_KEY, m.freeVal})
+	}
+	data := m.data
+	for i := 0; i < len(data); i += 2 {
+		if data[i] != FREE_KEY && m.seqs[i>>1] > version {
+			changes = append(changes, [2]uint64{data[i], data[i+1]})
+		}
+	}
+	return changes
+}
+
+// DeletedSince returns the keys, the free key included, deleted after
+// Version() returned version and absent now, each once, in unspecified order.
+// Keys deleted and inserted again are reported by ChangesSince instead. SetAll
+// counts as deleting every key it doesn't keep. It panics if the map was not
+// created with WithChangeTracking or version predates the last TrimChanges or
+// Reindex, after which a replica must start over from a full copy.
+func (m *Map) DeletedSince(version uint64) []uint64 {
+	if !m.tracked {
+		panic("DeletedSince requires WithChangeTracking")
+	}
+	if version < m.trimmed {
+		panic("Version predates TrimChanges or Reindex")
+	}
+	dels := m.dels
+	i := sort.Search(len(dels), func(i int) bool { return dels[i][0] > version })
+	seen := NewSet(1, 0.6)
+	var keys []uint64
+	for _, d := range dels[i:] {
+		if seen.Has(d[1]) {
+			continue
+		}
+		seen.Add(d[1])
+		if _, ok := m.peek(d[1]); !ok {
+			keys = append(keys, d[1])
+		}
+	}
+	return keys
+}
+
+// TrimChanges discards the deletion log up to version, once every consumer
+// has caught up with it, so the log doesn't grow without bound. Later calls
+// to DeletedSince must pass version or a later one.
+func (m *Map) TrimChanges(version uint64) {
+	if !m.tracked {
+		panic("TrimChanges requires WithChangeTracking")
+	}
+	if version <= m.trimmed {
+		return
+	}
+	dels := m.dels
+	i := sort.Search(len(dels), func(i int) bool { return dels[i][0] > version })
+	m.dels = append([][2]uint64(nil), dels[i:]...)
+	m.trimmed = version
+}
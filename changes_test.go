@@ -0,0 +1,118 @@
+package intintmap
+
+import (
+	"testing"
+)
+
+func TestChangesSince(t *testing.T) {
+	m := New(10, 0.6, WithChangeTracking())
+	var i uint64
+	for i = 0; i < 100; i++ {
+		m.Put(i, i)
+	}
+	v := m.Version()
+	if len(m.ChangesSince(v)) != 0 {
+		t.Errorf("didn't expect changes since the current version")
+	}
+	if len(m.ChangesSince(0)) != 100 {
+		t.Errorf("got %d changes since version 0, expected 100", len(m.ChangesSince(0)))
+	}
+
+	m.Put(0, 1000)                // update the free key
+	m.Put(5, 500)                 // update
+	m.Put(50, 50)                 // same value, still an update
+	m.Del(7)                      // reported by DeletedSince
+	for i = 1000; i < 2000; i++ { // insert, rehashing
+		m.Put(i, i)
+	}
+	for i = 1000; i < 1900; i++ { // delete, shifting entries
+		m.Del(i)
+	}
+
+	want := map[uint64]uint64{0: 1000, 5: 500, 50: 50}
+	for i = 1900; i < 2000; i++ {
+		want[i] = i
+	}
+	changes := m.ChangesSince(v)
+	if len(changes) != len(want) {
+		t.Errorf("got %d changes, expected %d", len(changes), len(want))
+	}
+	for _, kv := range changes {
+		if w, ok := want[kv[0]]; !ok || w != kv[1] {
+			t.Errorf("unexpected change %v", kv)
+		}
+	}
+
+	c := m.Clone()
+	c.Put(3, 3)
+	if len(m.ChangesSince(v)) != len(want) {
+		t.Errorf("expected changes to a clone to leave the original alone")
+	}
+}
+
+func TestDeletedSince(t *testing.T) {
+	m := New(10, 0.6, WithChangeTracking())
+	var i uint64
+	for i = 0; i < 100; i++ {
+		m.Put(i, i)
+	}
+	v := m.Version()
+	replica := m.Clone()
+
+	m.Del(0) // the free key
+	m.Del(7)
+	m.Del(8)
+	m.Put(8, 80) // deleted and reinserted
+	m.Del(9)
+	m.Del(9)         // absent, no change
+	m.DecayValues(3) // deletes keys 1 to 6, 7 is gone already
+	m.Put(200, 2)
+
+	deleted := map[uint64]bool{}
+	for _, k := range m.DeletedSince(v) {
+		if deleted[k] {
+			t.Errorf("key %d reported twice", k)
+		}
+		deleted[k] = true
+	}
+	for _, k := range []uint64{0, 1, 2, 3, 4, 5, 6, 7, 9} {
+		if !deleted[k] {
+			t.Errorf("expected key %d to be reported deleted", k)
+		}
+	}
+	if len(deleted) != 9 {
+		t.Errorf("got %d deleted keys, expected 9", len(deleted))
+	}
+
+	// A replica catches up by applying both feeds.
+	for k := range deleted {
+		replica.Del(k)
+	}
+	for _, kv := range m.ChangesSince(v) {
+		replica.Put(kv[0], kv[1])
+	}
+	if replica.Size() != m.Size() || replica.Checksum() != m.Checksum() {
+		t.Errorf("replica diverged from the map")
+	}
+
+	v = m.Version()
+	m.SetAll([]uint64{8, 300}, []uint64{1, 2})
+	deleted = map[uint64]bool{}
+	for _, k := range m.DeletedSince(v) {
+		deleted[k] = true
+	}
+	if len(deleted) != 91 || deleted[8] || deleted[300] || !deleted[200] {
+		t.Errorf("expected SetAll to report the 91 keys it dropped, got %d", len(deleted))
+	}
+
+	m.TrimChanges(m.Version())
+	if len(m.dels) != 0 {
+		t.Errorf("expected TrimChanges to empty the log, %d records left", len(m.dels))
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for a trimmed version")
+		}
+	}()
+	m.DeletedSince(v - 1)
+}
@@ -0,0 +1,61 @@
+package intintmap
+
+import (
+	"encoding/binary"
+	"hash"
+)
+
+// pairHash mixes a key-value pair into a well distributed 64-bit hash using
+// the splitmix64 finalizer.
+func pairHash(key, val uint64) uint64 {
+	h := key ^ (val+0x9E3779B97F4A7C15)*0xBF58476D1CE4E5B9
+	h = (h ^ (h >> 30)) * 0xBF58476D1CE4E5B9
+	h = (h ^ (h >> 27)) * 0x94D049BB133111EB
+	return h ^ (h >> 31)
+}
+
+// Checksum returns an order-independent fingerprint of the map's contents:
+// the XOR of a hash of every key-value pair. Maps with equal contents have
+// equal checksums regardless of capacity or history. It costs O(n).
+func (m *Map) Checksum() uint64 {
+	var c uint64
+	m.each(func(k, v uint64) bool {
+		c ^= pairHash(k, v)
+		return true
+	})
+	return c
+}
+
+// WithRunningChecksum makes the map keep its Checksum up to date on every
+// Put and Del, since XOR lets a pair's hash be added and removed again.
+func WithRunningChecksum() Option {
+	return func(m *Map) {
+		m.hooked = true
+		m.checksummed = true
+	}
+}
+
+// RunningChecksum returns Checksum() in O(1) for maps created with
+// WithRunningChecksum; for other maps it falls back to computing it.
+func (m *Map) RunningChecksum() uint64 {
+	if !m.checksummed {
+		return m.Checksum()
+	}
+	return m.checksum
+}
+
+// ContentHash writes every entry, the free key included, to h in ascending
+// key order as a little-endian key followed by a little-endian value, and
+// returns h.Sum64(). The canonical order makes the result depend only on
+// the contents, so it is stable across runs, capacities and histories, and
+// the caller picks the hash function. Entries are appended to whatever h
+// has already been written; reset it first for a hash of the map alone.
+func (m *Map) ContentHash(h hash.Hash64) uint64 {
+	var buf [16]byte
+	for _, kv := range m.sortedItems() {
+		binary.LittleEndian.PutUint64(buf[:8], kv[0])
+		binary.LittleEndian.PutUint64(buf[8:], kv[1])
+		h.Write(buf[:])
+	}
+	return h.Sum64()
+}
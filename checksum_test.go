@@ -0,0 +1,56 @@
+package intintmap
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"testing"
+)
+
+func TestRunningChecksum(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	m := New(10, 0.6, WithRunningChecksum())
+	for i := 0; i < 100000; i++ {
+		k := uint64(rng.Intn(2000))
+		switch rng.Intn(10) {
+		case 0, 1, 2:
+			m.Del(k)
+		case 3:
+			m.Rename(k, uint64(rng.Intn(2000)))
+		default:
+			m.Put(k, uint64(rng.Intn(100)))
+		}
+		if i%1000 == 0 {
+			m.DecayValues(1)
+		}
+		if m.RunningChecksum() != m.Checksum() {
+			t.Fatalf("running checksum diverged from Checksum() after %d operations", i)
+		}
+	}
+
+	n := New(10, 0.6)
+	for kv := range m.Items() {
+		n.Put(kv[0], kv[1])
+	}
+	if n.Checksum() != m.RunningChecksum() {
+		t.Errorf("expected equal checksums for maps with equal contents")
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	a, b := New(10, 0.6), New(1000, 0.6)
+	var i uint64
+	for i = 0; i < 500; i++ {
+		a.Put(i, i*i)
+	}
+	for i = 500; i > 0; i-- {
+		b.Put(i-1, (i-1)*(i-1))
+	}
+	if a.ContentHash(fnv.New64a()) != b.ContentHash(fnv.New64a()) {
+		t.Errorf("expected equal content hashes for maps with equal contents")
+	}
+
+	b.Put(0, 1)
+	if a.ContentHash(fnv.New64a()) == b.ContentHash(fnv.New64a()) {
+		t.Errorf("expected a different content hash after changing the free key")
+	}
+}
@@ -0,0 +1,422 @@
+package intintmap
+
+import (
+	"fmt"
+)
+
+// each calls fn for every key-value pair in the map, the free key first,
+// stopping early if fn returns false.
+func (m *Map) each(fn func(key, val uint64) bool) {
+	if m.hasFreeKey {
+		if !fn(FREE_KEY, m.freeVal) {
+			return
+		}
+	}
+
+	data := m.data
+	var k uint64
+	for i := 0; i < len(data); i += 2 {
+		k = data[i]
+		if k == FREE_KEY {
+			continue
+		}
+		if !fn(k, data[i+1]) {
+			return
+		}
+	}
+}
+
+// newSized returns an empty map able to hold size entries without growing,
+// using the fill factor of m.
+func (m *Map) newSized(size int) *Map {
+	if size < 1 {
+		size = 1
+	}
+	return New(size, m.fillFactor)
+}
+
+// DeltaMap returns a map holding, for every key whose value differs between
+// prev and next, the value next minus prev. Absent keys are treated as
+// holding 0, so added keys appear with their full value and removed keys
+// appear with the negated prev value; a key present on only one side always
+// appears, even if its value is 0 and so is its delta. The subtraction
+// wraps, so deltas are the two's complement encoding of the signed change:
+// int64(delta) recovers it, and adding a delta to the prev value always
+// yields the next one.
+func DeltaMap(prev, next *Map) *Map {
+	d := next.newSized(next.Size())
+
+	next.each(func(k, v uint64) bool {
+		if o, ok := prev.peek(k); !ok || v != o {
+			d.Put(k, v-o)
+		}
+		return true
+	})
+	prev.each(func(k, o uint64) bool {
+		if _, ok := next.peek(k); !ok {
+			d.Put(k, -o)
+		}
+		return true
+	})
+	return d
+}
+
+// CommonKeys returns the keys present in every one of maps, as a freshly
+// allocated slice in unspecified order. It iterates the smallest map and
+// probes the others, stopping at the first map lacking a key, so it costs
+// O(min size * len(maps)).
+func CommonKeys(maps ...*Map) []uint64 {
+	if len(maps) == 0 {
+		return nil
+	}
+	smallest := maps[0]
+	for _, m := range maps[1:] {
+		if m.Size() < smallest.Size() {
+			smallest = m
+		}
+	}
+
+	var keys []uint64
+	smallest.each(func(k, _ uint64) bool {
+		for _, m := range maps {
+			if _, ok := m.peek(k); !ok {
+				return true
+			}
+		}
+		keys = append(keys, k)
+		return true
+	})
+	return keys
+}
+
+// Split partitions the entries of m into n new maps of roughly equal size,
+// placing each key in map pairHash(key, 0) % n. The partition is by a hash
+// of the key alone, so a key always lands in the same output for a given n,
+// the free key included. Every entry lands in exactly one output and m is
+// left unchanged.
+func (m *Map) Split(n int) []*Map {
+	if n <= 0 {
+		panic("N must be positive")
+	}
+	parts := make([]*Map, n)
+	for i := range parts {
+		parts[i] = m.newSized(m.Size()/n + m.Size()/(4*n) + 1)
+	}
+	m.each(func(k, v uint64) bool {
+		parts[pairHash(k, 0)%uint64(n)].Put(k, v)
+		return true
+	})
+	return parts
+}
+
+// AddAll adds the value of every key in other to the value of the same key
+// in m, inserting absent keys with other's value. Sums wrap on uint64
+// overflow. Each key of other is looked up in m once.
+func (m *Map) AddAll(other *Map) {
+	m.Reserve(other.Size())
+	other.each(func(k, v uint64) bool {
+		if k == FREE_KEY {
+			o, _ := m.peek(k)
+			m.Put(k, o+v)
+			return true
+		}
+		ptr, ok := m.lookup(k)
+		if !ok {
+			m.putNew(ptr, k, v)
+			return true
+		}
+		if m.hooked {
+			m.onPut(ptr, k, m.data[ptr+1], m.data[ptr+1]+v, true)
+		}
+		m.data[ptr+1] += v
+		return true
+	})
+}
+
+// ApplyPatch deletes the keys in deletes and then stores every entry of
+// upserts. Deletes are applied first, so a key that is both deleted and
+// upserted ends up with its upserted value.
+func (m *Map) ApplyPatch(upserts *Map, deletes []uint64) {
+	for _, k := range deletes {
+		m.Del(k)
+	}
+	m.Reserve(upserts.Size())
+	upserts.each(func(k, v uint64) bool {
+		m.Put(k, v)
+		return true
+	})
+}
+
+// MergeDetectingConflicts stores every entry of other in m, other's value
+// winning, and returns the keys, the free key included, that were present
+// in both maps with different values. Keys present in both with equal values
+// are not conflicts. The result is nil if there were none.
+func (m *Map) MergeDetectingConflicts(other *Map) (conflicts []uint64) {
+	m.Reserve(other.Size())
+	other.each(func(k, v uint64) bool {
+		if o, ok := m.peek(k); ok && o != v {
+			conflicts = append(conflicts, k)
+		}
+		m.Put(k, v)
+		return true
+	})
+	return conflicts
+}
+
+// SignificantChanges returns the keys, the free key included, whose value
+// changed by at least minDelta in absolute terms between prev and next. A key
+// present on only one side is compared against 0, so a key that appears or
+// disappears counts as a change by its full value. A minDelta of 0 selects
+// every key of either map. It scans both maps once.
+func SignificantChanges(prev, next *Map, minDelta uint64) []uint64 {
+	var keys []uint64
+	next.each(func(k, v uint64) bool {
+		o, _ := prev.peek(k)
+		if absDiff(o, v) >= minDelta {
+			keys = append(keys, k)
+		}
+		return true
+	})
+	prev.each(func(k, o uint64) bool {
+		if _, ok := next.peek(k); !ok && o >= minDelta {
+			keys = append(keys, k)
+		}
+		return true
+	})
+	return keys
+}
+
+// absDiff returns |a - b|.
+func absDiff(a, b uint64) uint64 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
+
+// PackMaps combines maps into one, moving the keys of maps[i] into the
+// namespace i<<(64-prefixBits) | key so the top prefixBits bits of a packed
+// key hold the index of its source map. It returns an error if there are
+// more maps than prefixBits can number or a key does not fit in the low
+// 64-prefixBits bits. The free key of each map becomes its namespace's key
+// 0. The packed map uses the fill factor of maps[0]. Unpack extracts one
+// namespace again.
+func PackMaps(maps []*Map, prefixBits uint) (*Map, error) {
+	if prefixBits == 0 || prefixBits >= 64 {
+		return nil, fmt.Errorf("intintmap: prefix bits %d not in [1, 63]", prefixBits)
+	}
+	if len(maps) == 0 {
+		return nil, fmt.Errorf("intintmap: no maps to pack")
+	}
+	if uint64(len(maps)) > 1<<prefixBits {
+		return nil, fmt.Errorf("intintmap: %d maps don't fit in %d prefix bits", len(maps), prefixBits)
+	}
+
+	shift := 64 - prefixBits
+	size := 0
+	for _, m := range maps {
+		size += m.Size()
+	}
+	packed := maps[0].newSized(size)
+	for i, m := range maps {
+		var err error
+		m.each(func(k, v uint64) bool {
+			if k>>shift != 0 {
+				err = fmt.Errorf("intintmap: key %d of map %d doesn't fit in %d bits", k, i, shift)
+				return false
+			}
+			packed.Put(uint64(i)<<shift|k, v)
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return packed, nil
+}
+
+// Unpack returns a new map holding the entries of the namespace index of a
+// map built by PackMaps with the same prefixBits, with the prefix removed
+// from the keys.
+func Unpack(packed *Map, index int, prefixBits uint) *Map {
+	if prefixBits == 0 || prefixBits >= 64 {
+		panic("PrefixBits must be in [1, 63]")
+	}
+	shift := 64 - prefixBits
+	mask := uint64(1)<<shift - 1
+	m := packed.newSized(1)
+	packed.each(func(k, v uint64) bool {
+		if k>>shift == uint64(index) {
+			m.Put(k&mask, v)
+		}
+		return true
+	})
+	return m
+}
+
+// CoIterate calls fn once for every key in a or b, the free key included,
+// with each map's value and presence, stopping early if fn returns false.
+// The iteration order is unspecified; fn must not modify a or b.
+func CoIterate(a, b *Map, fn func(key uint64, aVal uint64, aOK bool, bVal uint64, bOK bool) bool) {
+	more := true
+	a.each(func(k, av uint64) bool {
+		bv, bok := b.peek(k)
+		more = fn(k, av, true, bv, bok)
+		return more
+	})
+	if !more {
+		return
+	}
+	b.each(func(k, bv uint64) bool {
+		if _, ok := a.peek(k); ok {
+			return true
+		}
+		return fn(k, 0, false, bv, true)
+	})
+}
+
+// LWWMerge merges other into m with last-writer-wins semantics: myTimes and
+// otherTimes hold the timestamp of each key of m and other, and for every
+// key of other the side with the later timestamp wins, updating both m and
+// myTimes. Keys only in other are taken from it; keys only in m are kept. A
+// missing timestamp counts as 0. Ties go to the larger value, so merging two
+// replicas in either order gives the same result.
+func (m *Map) LWWMerge(other *Map, myTimes, otherTimes *Map) {
+	other.each(func(k, ov uint64) bool {
+		ot, _ := otherTimes.peek(k)
+		if mv, ok := m.peek(k); ok {
+			mt, _ := myTimes.peek(k)
+			if mt > ot || (mt == ot && mv >= ov) {
+				return true
+			}
+		}
+		m.Put(k, ov)
+		myTimes.Put(k, ot)
+		return true
+	})
+}
+
+// Join returns the inner join of a and b: a new map holding the keys present
+// in both, the free key only if both have it, with the value
+// combine(key, aVal, bVal). It iterates the smaller map and probes the other,
+// and sizes the result for the smaller map, an upper bound on its size.
+func Join(a, b *Map, combine func(key, aVal, bVal uint64) uint64) *Map {
+	small, large := a, b
+	if large.Size() < small.Size() {
+		small, large = large, small
+	}
+	j := a.newSized(small.Size())
+	small.each(func(k, sv uint64) bool {
+		lv, ok := large.peek(k)
+		if !ok {
+			return true
+		}
+		if small == a {
+			j.Put(k, combine(k, sv, lv))
+		} else {
+			j.Put(k, combine(k, lv, sv))
+		}
+		return true
+	})
+	return j
+}
+
+// LeftJoin returns the left outer join of a and b: a new map holding every
+// key of a, the free key included, with the value combine(key, aVal, bVal),
+// where bVal is bDefault if b lacks the key. Keys only in b are left out. It
+// iterates a, probes b, and sizes the result for a.
+func LeftJoin(a, b *Map, bDefault uint64, combine func(key, aVal, bVal uint64) uint64) *Map {
+	j := a.newSized(a.Size())
+	a.each(func(k, av uint64) bool {
+		bv, ok := b.peek(k)
+		if !ok {
+			bv = bDefault
+		}
+		j.Put(k, combine(k, av, bv))
+		return true
+	})
+	return j
+}
+
+// MergeTrackingNew stores every entry of other in m, other's value winning,
+// and returns the keys, the free key included, that m did not hold before.
+// Overwritten keys are not reported. The result is nil if no key was new.
+func (m *Map) MergeTrackingNew(other *Map) (newKeys []uint64) {
+	m.Reserve(other.Size())
+	other.each(func(k, v uint64) bool {
+		if _, ok := m.peek(k); !ok {
+			newKeys = append(newKeys, k)
+		}
+		m.Put(k, v)
+		return true
+	})
+	return newKeys
+}
+
+// Extract removes every entry for which pred returns true, the free key
+// included, from m and returns them in a new map: a destructive partition
+// leaving the rest in m. It makes a single pass over m.
+func (m *Map) Extract(pred func(key, val uint64) bool) *Map {
+	out := m.newSized(1)
+	m.update(func(k, v uint64) (uint64, bool) {
+		if pred(k, v) {
+			out.Put(k, v)
+			return v, true
+		}
+		return v, false
+	})
+	return out
+}
+
+// OpKind is the kind of an Op.
+type OpKind uint8
+
+const (
+	OpSet    OpKind = iota // store Val under Key
+	OpDelete               // delete Key; Val is unused
+)
+
+// Op is one operation of a patch returned by PatchTo.
+type Op struct {
+	Kind OpKind
+	Key  uint64
+	Val  uint64
+}
+
+// PatchTo returns the operations that turn m into target: a delete for
+// every key only in m and a set for every key of target that m lacks or
+// holds with a different value, the free key included. Each key appears at
+// most once, so the operations can be applied in any order; keys with equal
+// values in both maps produce none. It scans both maps once; apply the
+// result with ApplyOps.
+func (m *Map) PatchTo(target *Map) []Op {
+	var ops []Op
+	m.each(func(k, _ uint64) bool {
+		if _, ok := target.peek(k); !ok {
+			ops = append(ops, Op{Kind: OpDelete, Key: k})
+		}
+		return true
+	})
+	target.each(func(k, v uint64) bool {
+		if o, ok := m.peek(k); !ok || o != v {
+			ops = append(ops, Op{Kind: OpSet, Key: k, Val: v})
+		}
+		return true
+	})
+	return ops
+}
+
+// ApplyOps applies ops to m in order, as returned by PatchTo. It panics on
+// an unknown OpKind.
+func (m *Map) ApplyOps(ops []Op) {
+	for _, op := range ops {
+		switch op.Kind {
+		case OpSet:
+			m.Put(op.Key, op.Val)
+		case OpDelete:
+			m.Del(op.Key)
+		default:
+			panic("Unknown op kind")
+		}
+	}
+}
@@ -0,0 +1,478 @@
+package intintmap
+
+import (
+	"testing"
+)
+
+func TestDeltaMap(t *testing.T) {
+	prev := New(10, 0.6)
+	prev.Put(0, 5)  // free key, changed
+	prev.Put(1, 10) // changed
+	prev.Put(2, 20) // unchanged
+	prev.Put(3, 30) // removed
+	prev.Put(6, 0)  // removed with value 0
+
+	next := New(10, 0.6)
+	next.Put(0, 7)
+	next.Put(1, 4)
+	next.Put(2, 20)
+	next.Put(4, 40) // added
+	next.Put(5, 0)  // added with value 0
+
+	d := DeltaMap(prev, next)
+	if d.Size() != 6 {
+		t.Errorf("size (%d) is not right, should be 6", d.Size())
+	}
+	if v, ok := d.Get(0); !ok || int64(v) != 2 {
+		t.Errorf("expected delta 2 for key 0, got %d", int64(v))
+	}
+	if v, ok := d.Get(1); !ok || int64(v) != -6 {
+		t.Errorf("expected delta -6 for key 1, got %d", int64(v))
+	}
+	if _, ok := d.Get(2); ok {
+		t.Errorf("didn't expect unchanged key 2 in delta")
+	}
+	if v, ok := d.Get(3); !ok || int64(v) != -30 {
+		t.Errorf("expected delta -30 for removed key 3, got %d", int64(v))
+	}
+	if v, ok := d.Get(4); !ok || v != 40 {
+		t.Errorf("expected delta 40 for added key 4, got %d", v)
+	}
+
+	if v, ok := d.Get(5); !ok || v != 0 {
+		t.Errorf("expected delta 0 for added key 5, got %d (%v)", v, ok)
+	}
+	if v, ok := d.Get(6); !ok || v != 0 {
+		t.Errorf("expected delta 0 for removed key 6, got %d (%v)", v, ok)
+	}
+
+	for kv := range d.Items() {
+		o, _ := prev.Get(kv[0])
+		n, _ := next.Get(kv[0])
+		if o+kv[1] != n {
+			t.Errorf("applying delta to key %d gives %d, expected %d", kv[0], o+kv[1], n)
+		}
+	}
+}
+
+func TestCommonKeys(t *testing.T) {
+	a, b, c := New(10, 0.6), New(10, 0.6), New(10, 0.6)
+	var i uint64
+	for i = 0; i < 100; i++ {
+		a.Put(i, i)
+		if i%2 == 0 {
+			b.Put(i, i)
+		}
+		if i%3 == 0 {
+			c.Put(i, i)
+		}
+	}
+
+	keys := CommonKeys(a, b, c)
+	if len(keys) != 17 {
+		t.Errorf("got %d common keys, expected 17", len(keys))
+	}
+	for _, k := range keys {
+		if k%6 != 0 {
+			t.Errorf("key %d is not common to all maps", k)
+		}
+	}
+
+	b.Del(0)
+	for _, k := range CommonKeys(a, b, c) {
+		if k == 0 {
+			t.Errorf("didn't expect the free key when one map lacks it")
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 10000; i++ {
+		m.Put(i, i+1)
+	}
+
+	parts := m.Split(4)
+	total := 0
+	for _, p := range parts {
+		total += p.Size()
+		if p.Size() < 2000 || p.Size() > 3000 {
+			t.Errorf("part size (%d) is too far from %d", p.Size(), 10000/4)
+		}
+	}
+	if total != m.Size() {
+		t.Errorf("parts hold %d entries, expected %d", total, m.Size())
+	}
+	for i = 0; i < 10000; i++ {
+		found := 0
+		for _, p := range parts {
+			if v, ok := p.Get(i); ok {
+				found++
+				if v != i+1 {
+					t.Errorf("expected %d as value for key %d, got %d", i+1, i, v)
+				}
+			}
+		}
+		if found != 1 {
+			t.Errorf("key %d found in %d parts, expected 1", i, found)
+		}
+	}
+}
+
+func TestAddAll(t *testing.T) {
+	m, other := New(10, 0.6, WithRunningChecksum()), New(10, 0.6)
+	m.Put(0, 1)
+	m.Put(1, 10)
+	m.Put(2, ^uint64(0))
+	other.Put(0, 2)
+	other.Put(2, 2)
+	other.Put(3, 30)
+
+	m.AddAll(other)
+	for k, want := range map[uint64]uint64{0: 3, 1: 10, 2: 1, 3: 30} {
+		if v, ok := m.Get(k); !ok || v != want {
+			t.Errorf("expected %d as value for key %d, got %d", want, k, v)
+		}
+	}
+	if m.Size() != 4 {
+		t.Errorf("size (%d) is not right, should be 4", m.Size())
+	}
+	if m.RunningChecksum() != m.Checksum() {
+		t.Errorf("running checksum is out of date after AddAll")
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	m := New(10, 0.6)
+	m.Put(0, 1)
+	m.Put(1, 1)
+	m.Put(2, 1)
+
+	upserts := New(10, 0.6)
+	upserts.Put(2, 20)
+	upserts.Put(3, 30)
+	upserts.Put(0, 10)
+	m.ApplyPatch(upserts, []uint64{0, 1, 4})
+
+	for k, want := range map[uint64]uint64{0: 10, 2: 20, 3: 30} {
+		if v, ok := m.Get(k); !ok || v != want {
+			t.Errorf("expected %d as value for key %d, got %d", want, k, v)
+		}
+	}
+	if _, ok := m.Get(1); ok {
+		t.Errorf("didn't expect deleted key 1")
+	}
+	if m.Size() != 3 {
+		t.Errorf("size (%d) is not right, should be 3", m.Size())
+	}
+}
+
+func TestMergeDetectingConflicts(t *testing.T) {
+	m, other := New(10, 0.6), New(10, 0.6)
+	m.Put(0, 1)
+	m.Put(1, 1)
+	m.Put(2, 2)
+	other.Put(0, 5)
+	other.Put(2, 2)
+	other.Put(3, 3)
+
+	conflicts := m.MergeDetectingConflicts(other)
+	if len(conflicts) != 1 || conflicts[0] != 0 {
+		t.Errorf("expected only key 0 to conflict, got %v", conflicts)
+	}
+	for k, want := range map[uint64]uint64{0: 5, 1: 1, 2: 2, 3: 3} {
+		if v, ok := m.Get(k); !ok || v != want {
+			t.Errorf("expected %d as value for key %d, got %d", want, k, v)
+		}
+	}
+	if m.MergeDetectingConflicts(other) != nil {
+		t.Errorf("didn't expect conflicts merging the same map twice")
+	}
+}
+
+func TestSignificantChanges(t *testing.T) {
+	prev, next := New(10, 0.6), New(10, 0.6)
+	prev.Put(0, 100) // free key, +50
+	prev.Put(1, 100) // -5, noise
+	prev.Put(2, 100) // -20
+	prev.Put(3, 30)  // disappears
+	prev.Put(4, 5)   // disappears, noise
+	next.Put(0, 150)
+	next.Put(1, 95)
+	next.Put(2, 80)
+	next.Put(5, 10) // appears
+
+	got := map[uint64]bool{}
+	for _, k := range SignificantChanges(prev, next, 10) {
+		got[k] = true
+	}
+	for _, k := range []uint64{0, 2, 3, 5} {
+		if !got[k] {
+			t.Errorf("expected key %d to be a significant change", k)
+		}
+	}
+	if len(got) != 4 {
+		t.Errorf("got %d significant changes, expected 4", len(got))
+	}
+}
+
+func TestPackMaps(t *testing.T) {
+	maps := make([]*Map, 3)
+	for i := range maps {
+		maps[i] = New(10, 0.6)
+		maps[i].Put(0, uint64(i)+100)
+		for k := uint64(1); k < 50; k++ {
+			maps[i].Put(k, k*uint64(i+1))
+		}
+	}
+
+	packed, err := PackMaps(maps, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packed.Size() != 150 {
+		t.Errorf("size (%d) is not right, should be 150", packed.Size())
+	}
+	for i, m := range maps {
+		u := Unpack(packed, i, 2)
+		if u.Size() != m.Size() {
+			t.Errorf("unpacked size (%d) is not right, should be %d", u.Size(), m.Size())
+		}
+		for kv := range m.Items() {
+			if v, ok := u.Get(kv[0]); !ok || v != kv[1] {
+				t.Errorf("expected %d as value for key %d of map %d, got %d", kv[1], kv[0], i, v)
+			}
+		}
+	}
+
+	if _, err = PackMaps(append(maps, New(1, 0.6), New(1, 0.6)), 2); err == nil {
+		t.Errorf("expected an error for too many maps")
+	}
+	maps[1].Put(1<<62, 1)
+	if _, err = PackMaps(maps, 2); err == nil {
+		t.Errorf("expected an error for a key that doesn't fit")
+	}
+}
+
+func TestCoIterate(t *testing.T) {
+	a, b := New(10, 0.6), New(10, 0.6)
+	a.Put(0, 1)
+	a.Put(1, 2)
+	b.Put(1, 3)
+	b.Put(2, 4)
+
+	seen := map[uint64][4]uint64{}
+	CoIterate(a, b, func(k, av uint64, aok bool, bv uint64, bok bool) bool {
+		if _, ok := seen[k]; ok {
+			t.Errorf("key %d visited twice", k)
+		}
+		var ao, bo uint64
+		if aok {
+			ao = 1
+		}
+		if bok {
+			bo = 1
+		}
+		seen[k] = [4]uint64{av, ao, bv, bo}
+		return true
+	})
+	want := map[uint64][4]uint64{0: {1, 1, 0, 0}, 1: {2, 1, 3, 1}, 2: {0, 0, 4, 1}}
+	if len(seen) != len(want) {
+		t.Errorf("visited %d keys, expected %d", len(seen), len(want))
+	}
+	for k, w := range want {
+		if seen[k] != w {
+			t.Errorf("unexpected visit for key %d: %v, expected %v", k, seen[k], w)
+		}
+	}
+
+	n := 0
+	CoIterate(a, b, func(uint64, uint64, bool, uint64, bool) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("expected iteration to stop after the first key, got %d calls", n)
+	}
+}
+
+func TestLWWMerge(t *testing.T) {
+	replica := func(vals, times map[uint64]uint64) (*Map, *Map) {
+		m, ts := New(10, 0.6), New(10, 0.6)
+		for k, v := range vals {
+			m.Put(k, v)
+			ts.Put(k, times[k])
+		}
+		return m, ts
+	}
+	aVals := map[uint64]uint64{0: 1, 1: 1, 2: 1, 3: 7}
+	aTimes := map[uint64]uint64{0: 5, 1: 1, 2: 3, 3: 4}
+	bVals := map[uint64]uint64{0: 2, 1: 2, 2: 2, 4: 2}
+	bTimes := map[uint64]uint64{0: 2, 1: 6, 2: 3, 4: 1}
+	want := map[uint64][2]uint64{0: {1, 5}, 1: {2, 6}, 2: {2, 3}, 3: {7, 4}, 4: {2, 1}}
+
+	a, at := replica(aVals, aTimes)
+	b, bt := replica(bVals, bTimes)
+	a.LWWMerge(b, at, bt)
+
+	b2, bt2 := replica(bVals, bTimes)
+	a2, at2 := replica(aVals, aTimes)
+	b2.LWWMerge(a2, bt2, at2)
+
+	for _, r := range [][2]*Map{{a, at}, {b2, bt2}} {
+		if r[0].Size() != len(want) {
+			t.Errorf("size (%d) is not right, should be %d", r[0].Size(), len(want))
+		}
+		for k, w := range want {
+			v, _ := r[0].Get(k)
+			ts, _ := r[1].Get(k)
+			if v != w[0] || ts != w[1] {
+				t.Errorf("expected value %d at time %d for key %d, got %d at %d", w[0], w[1], k, v, ts)
+			}
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	a, b := New(10, 0.6), New(10, 0.6)
+	var i uint64
+	for i = 0; i < 100; i++ {
+		a.Put(i, i)
+	}
+	for i = 0; i < 10; i++ {
+		b.Put(i*20, 3)
+	}
+
+	sub := func(_, x, y uint64) uint64 { return x - y }
+	for _, j := range []*Map{Join(a, b, sub), Join(b, a, func(k, x, y uint64) uint64 { return sub(k, y, x) })} {
+		if j.Size() != 5 {
+			t.Errorf("size (%d) is not right, should be 5", j.Size())
+		}
+		for i = 0; i < 100; i += 20 {
+			if v, ok := j.Get(i); !ok || v != i-3 {
+				t.Errorf("expected %d as value for key %d, got %d", i-3, i, v)
+			}
+		}
+	}
+
+	b.Del(0)
+	if _, ok := Join(a, b, sub).Get(0); ok {
+		t.Errorf("didn't expect the free key when only one map has it")
+	}
+}
+
+func TestLeftJoin(t *testing.T) {
+	a, b := New(10, 0.6), New(10, 0.6)
+	a.Put(0, 1)
+	a.Put(1, 2)
+	b.Put(1, 10)
+	b.Put(2, 20)
+
+	j := LeftJoin(a, b, 100, func(_, x, y uint64) uint64 { return x + y })
+	if j.Size() != 2 {
+		t.Errorf("size (%d) is not right, should be 2", j.Size())
+	}
+	for k, want := range map[uint64]uint64{0: 101, 1: 12} {
+		if v, ok := j.Get(k); !ok || v != want {
+			t.Errorf("expected %d as value for key %d, got %d", want, k, v)
+		}
+	}
+	if _, ok := j.Get(2); ok {
+		t.Errorf("didn't expect key 2, which is only in b")
+	}
+}
+
+func TestMergeTrackingNew(t *testing.T) {
+	m, other := New(10, 0.6), New(10, 0.6)
+	m.Put(1, 1)
+	other.Put(0, 5)
+	other.Put(1, 2)
+	other.Put(2, 3)
+
+	got := map[uint64]bool{}
+	for _, k := range m.MergeTrackingNew(other) {
+		got[k] = true
+	}
+	if len(got) != 2 || !got[0] || !got[2] {
+		t.Errorf("expected keys 0 and 2 to be new, got %v", got)
+	}
+	if v, _ := m.Get(1); v != 2 {
+		t.Errorf("expected other's value to win, got %d", v)
+	}
+	if m.MergeTrackingNew(other) != nil {
+		t.Errorf("didn't expect new keys merging the same map twice")
+	}
+}
+
+func TestExtract(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 10000; i++ {
+		m.Put(i, i*3)
+	}
+	orig := m.Clone()
+
+	out := m.Extract(func(k, v uint64) bool { return k%3 == 0 || v > 20000 })
+	if m.Size()+out.Size() != orig.Size() {
+		t.Errorf("sizes %d + %d don't add up to %d", m.Size(), out.Size(), orig.Size())
+	}
+	if _, ok := out.Get(0); !ok {
+		t.Errorf("expected the free key to be extracted")
+	}
+	m.each(func(k, v uint64) bool {
+		if k%3 == 0 || v > 20000 {
+			t.Errorf("matching key %d was left behind", k)
+		}
+		return true
+	})
+	out.each(func(k, v uint64) bool {
+		if !(k%3 == 0 || v > 20000) {
+			t.Errorf("non-matching key %d was extracted", k)
+		}
+		return true
+	})
+
+	union := m.Clone()
+	union.AddAll(out) // the key sets are disjoint
+	if union.Size() != orig.Size() || union.Checksum() != orig.Checksum() {
+		t.Errorf("extracted and remaining entries don't reconstruct the original")
+	}
+}
+
+func TestPatchTo(t *testing.T) {
+	m := New(10, 0.6)
+	target := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 1000; i++ {
+		m.Put(i, i)
+		switch i % 4 {
+		case 0: // deleted, the free key included
+		case 1:
+			target.Put(i, i) // unchanged
+		default:
+			target.Put(i, i+1) // changed
+		}
+		target.Put(i+1000, i) // added
+	}
+
+	ops := m.PatchTo(target)
+	if len(ops) != 250+500+1000 {
+		t.Errorf("got %d operations, expected %d", len(ops), 250+500+1000)
+	}
+	c := m.Clone()
+	c.ApplyOps(ops)
+	if c.Size() != target.Size() || c.Checksum() != target.Checksum() {
+		t.Errorf("applying the patch didn't yield the target")
+	}
+	if ops = target.PatchTo(c); len(ops) != 0 {
+		t.Errorf("got %d operations between equal maps, expected 0", len(ops))
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for an unknown op kind")
+		}
+	}()
+	c.ApplyOps([]Op{{Kind: OpDelete + 1}})
+}
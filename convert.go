@@ -0,0 +1,51 @@
+package intintmap
+
+// KV is a key-value pair with named fields.
+type KV struct {
+	Key, Val uint64
+}
+
+// ToStructs returns all key-value pairs, the free key included, in
+// unspecified order.
+func (m *Map) ToStructs() []KV {
+	kvs := make([]KV, 0, m.Size())
+	m.each(func(k, v uint64) bool {
+		kvs = append(kvs, KV{k, v})
+		return true
+	})
+	return kvs
+}
+
+// FromStructs returns a map holding the given pairs, sized so that building
+// it never rehashes. Later pairs win over earlier ones with the same key.
+func FromStructs(kvs []KV, fillFactor float64) *Map {
+	m := New(len(kvs)+1, fillFactor)
+	for _, kv := range kvs {
+		m.Put(kv.Key, kv.Val)
+	}
+	return m
+}
+
+// BuildSorted returns a map holding sortedUniqueKeys[i] -> vals[i], sized so
+// that building it never rehashes. Since the keys are promised to be unique,
+// each one is stored at the first free slot of its probe sequence without
+// checking for an existing copy, which makes loading a precomputed,
+// deduplicated dataset faster than SetAll or Put. Sorting isn't needed for
+// correctness; it only documents the typical input. If a key is repeated the
+// result is undefined. It panics if the slices differ in length.
+func BuildSorted(sortedUniqueKeys, vals []uint64, fillFactor float64) *Map {
+	if len(sortedUniqueKeys) != len(vals) {
+		panic("Keys and vals must have equal lengths")
+	}
+	m := New(len(sortedUniqueKeys)+1, fillFactor)
+	for i, k := range sortedUniqueKeys {
+		if k == FREE_KEY {
+			m.hasFreeKey = true
+			m.freeVal = vals[i]
+			m.size++
+		} else {
+			m.insert(k, vals[i])
+		}
+	}
+	return m
+}
@@ -0,0 +1,84 @@
+package intintmap
+
+import (
+	"testing"
+)
+
+func TestStructs(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 1000; i++ {
+		m.Put(i, i*3)
+	}
+
+	kvs := m.ToStructs()
+	if len(kvs) != m.Size() {
+		t.Errorf("got %d pairs, expected %d", len(kvs), m.Size())
+	}
+	n := FromStructs(kvs, 0.6)
+	if n.Size() != m.Size() {
+		t.Errorf("size (%d) is not right, should be %d", n.Size(), m.Size())
+	}
+	for i = 0; i < 1000; i++ {
+		if v, ok := n.Get(i); !ok || v != i*3 {
+			t.Errorf("expected %d as value for key %d, got %d", i*3, i, v)
+		}
+	}
+}
+
+func TestBuildSorted(t *testing.T) {
+	keys := make([]uint64, 1000)
+	vals := make([]uint64, 1000)
+	for i := range keys {
+		keys[i] = uint64(i * 3)
+		vals[i] = uint64(i)
+	}
+
+	m := BuildSorted(keys, vals, 0.6)
+	if m.Size() != len(keys) {
+		t.Errorf("size (%d) is not right, should be %d", m.Size(), len(keys))
+	}
+	for i, k := range keys {
+		if v, ok := m.Get(k); !ok || v != vals[i] {
+			t.Errorf("expected %d as value for key %d, got %d", vals[i], k, v)
+		}
+	}
+	m.Put(3000, 1) // the map keeps working as usual
+	m.Del(0)
+	if m.Size() != len(keys) {
+		t.Errorf("size (%d) is not right, should be %d", m.Size(), len(keys))
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for mismatched lengths")
+		}
+	}()
+	BuildSorted(keys, vals[1:], 0.6)
+}
+
+func benchmarkSortedInput() (keys, vals []uint64) {
+	keys = make([]uint64, 1<<20)
+	vals = make([]uint64, len(keys))
+	for i := range keys {
+		keys[i] = uint64(i) * 7
+		vals[i] = uint64(i)
+	}
+	return keys, vals
+}
+
+func BenchmarkBuildSorted(b *testing.B) {
+	keys, vals := benchmarkSortedInput()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		BuildSorted(keys, vals, 0.6)
+	}
+}
+
+func BenchmarkBuildSortedSetAll(b *testing.B) {
+	keys, vals := benchmarkSortedInput()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		New(1, 0.6).SetAll(keys, vals)
+	}
+}
@@ -0,0 +1,79 @@
+package intintmap
+
+// mix returns the hash of key whose low bits pick its home slot.
+func (m *Map) mix(key uint64) uint64 {
+	if h := m.hash; h != nil {
+		return h(key)
+	}
+	return phiMix(key)
+}
+
+// putHashed, delHashed and insertHashed are Put, Del and insert for maps
+// with a custom hash, kept apart so the phiMix paths stay free of indirect
+// calls; getSlow serves Get. key must not be the free key.
+func (m *Map) putHashed(key, val uint64) {
+	ptr, ok := m.lookup(key)
+	if !ok {
+		m.putNew(ptr, key, val)
+		return
+	}
+	if m.hooked {
+		m.onPut(ptr, key, m.data[ptr+1], val, true)
+	}
+	m.data[ptr+1] = val
+}
+
+func (m *Map) delHashed(key uint64) {
+	ptr, ok := m.lookup(key)
+	if !ok {
+		return
+	}
+	if m.hooked {
+		m.onDel(key, m.data[ptr+1])
+	}
+	m.shiftKeys(ptr)
+	m.size--
+	if m.shrinkLoad > 0 {
+		m.maybeShrink()
+	}
+}
+
+func (m *Map) insertHashed(key, val uint64) uint64 {
+	ptr, _ := m.lookup(key)
+	m.insertAt(ptr, key, val)
+	return ptr
+}
+
+// WithHash makes the map place keys by hash instead of the built-in phiMix,
+// e.g. a hash seeded per process to resist hash flooding, and allows
+// replacing it later with SetHash. Home slots are taken from the low bits of
+// the hash, which must therefore be well mixed. Maps derived from this one,
+// such as the results of Split or Join, use phiMix.
+func WithHash(hash func(uint64) uint64) Option {
+	return func(m *Map) {
+		m.hash = hash
+		m.slow = true
+	}
+}
+
+// SetHash replaces the hash of a map created with WithHash and immediately
+// moves every entry to its place under the new hash, e.g. to switch to a
+// freshly seeded hash once IsDegraded reports flooding. The table is rebuilt
+// into a new backing array of the same size, costing O(n) time and memory,
+// and swapped in only once complete, so m is left unchanged if hash panics.
+// It panics if the map wasn't created with WithHash.
+func (m *Map) SetHash(hash func(uint64) uint64) {
+	if m.hash == nil {
+		panic("Map must be created with WithHash")
+	}
+	if hash == nil {
+		panic("Hash must not be nil")
+	}
+	n := *m
+	n.hash = hash
+	n.resize(len(m.data) / 2)
+	// The later WithHash wins when the options are replayed, as by
+	// UnmarshalBinary.
+	n.opts = append(m.opts[:len(m.opts):len(m.opts)], WithHash(hash))
+	*m = n
+}
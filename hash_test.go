@@ -0,0 +1,123 @@
+package intintmap
+
+import (
+	"testing"
+)
+
+func TestSetHash(t *testing.T) {
+	seeded := func(seed uint64) func(uint64) uint64 {
+		return func(k uint64) uint64 { return pairHash(k, seed) }
+	}
+	m := New(10, 0.6, WithHash(seeded(1)))
+	var i uint64
+	for i = 0; i < 10000; i++ {
+		m.Put(i, i+1)
+	}
+	sum := m.Checksum()
+	slots := len(m.data)
+
+	m.SetHash(seeded(2))
+	if len(m.data) != slots {
+		t.Errorf("table has %d slots after SetHash, expected %d", len(m.data)/2, slots/2)
+	}
+	if m.Size() != 10000 || m.Checksum() != sum {
+		t.Errorf("SetHash changed the contents")
+	}
+	for i = 0; i < 10000; i++ {
+		if v, ok := m.Get(i); !ok || v != i+1 {
+			t.Errorf("expected %d as value for key %d, got %d", i+1, i, v)
+		}
+	}
+	m.ItemsWithProbeDistance(func(k, _ uint64, dist int) bool {
+		if home, _ := m.IsAtHome(k); home != (dist == 0) {
+			t.Errorf("key %d is not placed by the new hash", k)
+		}
+		return true
+	})
+
+	for i = 0; i < 10000; i += 2 {
+		m.Del(i)
+	}
+	for i = 0; i < 10000; i++ {
+		if _, ok := m.Get(i); ok != (i%2 == 1) {
+			t.Errorf("unexpected presence %v of key %d", ok, i)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for a map without WithHash")
+		}
+	}()
+	New(10, 0.6).SetHash(seeded(3))
+}
+
+func TestSetHashSurvivesUnmarshal(t *testing.T) {
+	m := New(10, 0.6, WithHash(phiMix))
+	var i uint64
+	for i = 1; i <= 100; i++ {
+		m.Put(i, i)
+	}
+	calls := 0
+	m.SetHash(func(k uint64) uint64 {
+		calls++
+		return pairHash(k, 1)
+	})
+
+	b, _ := m.MarshalBinary()
+	if err := m.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	calls = 0
+	for i = 1; i <= 100; i++ {
+		if v, ok := m.Get(i); !ok || v != i {
+			t.Errorf("expected %d as value for key %d, got %d", i, i, v)
+		}
+	}
+	if calls != 100 {
+		t.Errorf("got %d calls of the hash set by SetHash, expected 100", calls)
+	}
+}
+
+func TestSetHashPanicLeavesMap(t *testing.T) {
+	m := New(10, 0.6, WithHash(phiMix))
+	var i uint64
+	for i = 1; i <= 100; i++ {
+		m.Put(i, i)
+	}
+
+	func() {
+		defer func() { recover() }()
+		m.SetHash(func(k uint64) uint64 {
+			if k == 50 {
+				panic("boom")
+			}
+			return k
+		})
+	}()
+	for i = 1; i <= 100; i++ {
+		if v, ok := m.Get(i); !ok || v != i {
+			t.Errorf("expected %d as value for key %d, got %d", i, i, v)
+		}
+	}
+}
+
+func TestHashedRebuilds(t *testing.T) {
+	m := New(10, 0.6, WithHash(func(k uint64) uint64 { return pairHash(k, 7) }))
+	keys := make([]uint64, 1000)
+	vals := make([]uint64, 1000)
+	for i := range keys {
+		keys[i], vals[i] = uint64(i), uint64(i*2)
+	}
+
+	m.SetAll(keys, vals)
+	m.Reindex()
+	if m.Size() != len(keys) {
+		t.Errorf("size (%d) is not right, should be %d", m.Size(), len(keys))
+	}
+	for i, k := range keys {
+		if v, ok := m.Get(k); !ok || v != vals[i] {
+			t.Errorf("expected %d as value for key %d, got %d", vals[i], k, v)
+		}
+	}
+}
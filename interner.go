@@ -0,0 +1,38 @@
+package intintmap
+
+// ValueInterner assigns each distinct uint64 value a dense ID, 0, 1, 2, ...
+// in first-seen order, so a column of repeated large values can be stored as
+// small indexes. Value 0 is interned like any other value.
+type ValueInterner struct {
+	ids    *Map // value -> ID
+	values []uint64
+}
+
+// NewValueInterner returns an interner sized for size distinct values.
+func NewValueInterner(size int, fillFactor float64) *ValueInterner {
+	return &ValueInterner{
+		ids:    New(size, fillFactor),
+		values: make([]uint64, 0, size),
+	}
+}
+
+// Intern returns the ID of v, assigning the next free ID if v is new.
+func (in *ValueInterner) Intern(v uint64) uint64 {
+	if id, ok := in.ids.Get(v); ok {
+		return id
+	}
+	id := uint64(len(in.values))
+	in.ids.Put(v, id)
+	in.values = append(in.values, v)
+	return id
+}
+
+// Value returns the value interned as id. It panics if id was never assigned.
+func (in *ValueInterner) Value(id uint64) uint64 {
+	return in.values[id]
+}
+
+// Len returns the number of distinct values interned.
+func (in *ValueInterner) Len() int {
+	return len(in.values)
+}
@@ -0,0 +1,24 @@
+package intintmap
+
+import (
+	"testing"
+)
+
+func TestValueInterner(t *testing.T) {
+	in := NewValueInterner(10, 0.6)
+	values := []uint64{1 << 60, 0, 1 << 60, 7, 0, 1 << 61}
+	ids := []uint64{0, 1, 0, 2, 1, 3}
+	for i, v := range values {
+		if id := in.Intern(v); id != ids[i] {
+			t.Errorf("expected ID %d for value %d, got %d", ids[i], v, id)
+		}
+	}
+	if in.Len() != 4 {
+		t.Errorf("size (%d) is not right, should be 4", in.Len())
+	}
+	for i, v := range values {
+		if got := in.Value(ids[i]); got != v {
+			t.Errorf("expected value %d for ID %d, got %d", v, ids[i], got)
+		}
+	}
+}
@@ -4,7 +4,9 @@
 package intintmap
 
 import (
+	"fmt"
 	"math"
+	"time"
 )
 
 // INT_PHI is for scrambling the keys
@@ -27,9 +29,43 @@ type Map struct {
 
 	mask  uint64 // mask to calculate the original position
 	mask2 uint64
+	hash  func(uint64) uint64 // set by WithHash, nil for phiMix
+	slow  bool                // must Get take getSlow?
 
 	hasFreeKey bool  // do we have 'free' key in the map?
 	freeVal    uint64 // value of 'free' key
+
+	opts   []Option // options the map was created with
+	hooked bool     // does any option need onPut/onDel calls?
+
+	checksummed bool   // maintain checksum on every change?
+	checksum    uint64 // running Checksum() when checksummed
+
+	tracked bool        // record the version of every change?
+	version uint64      // number of changes so far when tracked
+	seqs    []uint64    // per slot version of the last change when tracked
+	freeSeq uint64      // version of the last change of the free key
+	dels    [][2]uint64 // version and key of every deletion when tracked
+	trimmed uint64      // version up to which dels was trimmed
+
+	counted  bool     // count successful lookups of every key?
+	hits     []uint64 // per slot lookup count when counted
+	freeHits uint64   // lookup count of the free key
+
+	ranged     bool   // maintain the minimum and maximum value?
+	rangeStale bool   // must minVal and maxVal be recomputed?
+	minVal     uint64 // smallest value when ranged and not stale
+	maxVal     uint64 // largest value when ranged and not stale
+
+	shrinkLoad float64          // load below which deletions shrink, 0 for never
+	cooldown   time.Duration    // least time between optional rehashes
+	now        func() time.Time // clock for cooldown, time.Now by default
+	lastRehash time.Time        // time of the last rehash when cooldown > 0
+	shrinkDue  bool             // was a shrink put off by the cooldown?
+
+	degradedFactor float64 // IsDegraded threshold, 0 for the default
+
+	meta any // opaque caller tag, see SetMeta
 }
 
 func nextPowerOf2(x uint32) uint32 {
@@ -42,7 +78,7 @@ func nextPowerOf2(x uint32) uint32 {
 	x |= x >> 4
 	x |= x >> 8
 	x |= x >> 16
-	return (x | x>>32) + 1
+	return x + 1
 }
 
 func arraySize(exp int, fill float64) int {
@@ -55,7 +91,7 @@ func arraySize(exp int, fill float64) int {
 
 // New returns a map initialized with n spaces and uses the stated fillFactor.
 // The map will grow as needed.
-func New(size int, fillFactor float64) *Map {
+func New(size int, fillFactor float64, opts ...Option) *Map {
 	if fillFactor <= 0 || fillFactor >= 1 {
 		panic("FillFactor must be in (0, 1)")
 	}
@@ -64,17 +100,55 @@ func New(size int, fillFactor float64) *Map {
 	}
 
 	capacity := arraySize(size, fillFactor)
-	return &Map{
+	m := &Map{
 		data:       make([]uint64, 2*capacity),
 		fillFactor: fillFactor,
 		threshold:  int(math.Floor(float64(capacity) * fillFactor)),
 		mask:       uint64(capacity - 1),
 		mask2:      uint64(2*capacity - 1),
+		opts:       opts,
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// NewFromPool returns an empty map using the stated fillFactor that adopts
+// buf, typically a slice returned by Release and kept in a sync.Pool, as its
+// backing array. buf must be all zeros and hold at least 4 elements; the map
+// uses its largest prefix of a power-of-two length and grows as needed.
+func NewFromPool(buf []uint64, fillFactor float64, opts ...Option) *Map {
+	if fillFactor <= 0 || fillFactor >= 1 {
+		panic("FillFactor must be in (0, 1)")
+	}
+	if len(buf) < 4 {
+		panic("Buffer must hold at least 4 elements")
+	}
+
+	capacity := 2
+	for 4*capacity <= len(buf) {
+		capacity *= 2
+	}
+	m := &Map{
+		data:       buf[:2*capacity],
+		fillFactor: fillFactor,
+		threshold:  int(math.Floor(float64(capacity) * fillFactor)),
+		mask:       uint64(capacity - 1),
+		mask2:      uint64(2*capacity - 1),
+		opts:       opts,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
 }
 
 // Get returns the value if the key is found.
 func (m *Map) Get(key uint64) (uint64, bool) {
+	if m.slow {
+		return m.getSlow(key)
+	}
 	if key == FREE_KEY {
 		if m.hasFreeKey {
 			return m.freeVal, true
@@ -95,8 +169,13 @@ func (m *Map) Get(key uint64) (uint64, bool) {
 		return m.data[ptr+1], true
 	}
 
+	var probes int
 	for {
 		ptr = (ptr + 2) & m.mask2
+		if probeGuard {
+			probes++
+			m.checkProbes("Get", key, probes)
+		}
 		k = m.data[ptr]
 		if k == FREE_KEY {
 			return 0, false
@@ -107,9 +186,121 @@ func (m *Map) Get(key uint64) (uint64, bool) {
 	}
 }
 
+// getSlow is Get for maps that count accesses or use a custom hash, kept
+// apart so the phiMix loop of Get stays as tight as possible.
+func (m *Map) getSlow(key uint64) (uint64, bool) {
+	if key == FREE_KEY {
+		if m.hasFreeKey {
+			if m.counted {
+				m.freeHits++
+			}
+			return m.freeVal, true
+		}
+		return 0, false
+	}
+	ptr, ok := m.lookup(key)
+	if !ok {
+		return 0, false
+	}
+	if m.counted {
+		m.hits[ptr>>1]++
+	}
+	return m.data[ptr+1], true
+}
+
+// GetPtr returns a pointer to the value of key, or nil if the key is
+// absent, so the value can be read and updated in place with one probe. The
+// pointer aliases the map's storage: it is invalidated by any Put that may
+// grow the map and by any Del. Writes through it can't be observed, so
+// GetPtr panics on maps created with WithRunningChecksum or
+// WithChangeTracking, and makes a map created with WithRunningMinMax
+// recompute its range on the next MinMax.
+func (m *Map) GetPtr(key uint64) *uint64 {
+	if m.checksummed || m.tracked {
+		panic("GetPtr can't be used with WithRunningChecksum or WithChangeTracking")
+	}
+	if key == FREE_KEY {
+		if m.hasFreeKey {
+			if m.counted {
+				m.freeHits++
+			}
+			if m.ranged {
+			m.rangeStale = true
+		}
+			return &m.freeVal
+		}
+		return nil
+	}
+	if ptr, ok := m.lookup(key); ok {
+		if m.counted {
+			m.hits[ptr>>1]++
+		}
+		if m.ranged {
+			m.rangeStale = true
+		}
+		return &m.data[ptr+1]
+	}
+	return nil
+}
+
+// lookup returns the position in data of a non-zero key, or, if it is
+// absent, of the free slot that ends its probe sequence.
+func (m *Map) lookup(key uint64) (uint64, bool) {
+	ptr := (m.mix(key) & m.mask) << 1
+	var k uint64
+	var probes int
+	for {
+		k = m.data[ptr]
+		if k == key {
+			return ptr, true
+		}
+		if k == FREE_KEY {
+			return ptr, false
+		}
+		ptr = (ptr + 2) & m.mask2
+		if probeGuard {
+			probes++
+			m.checkProbes("lookup", key, probes)
+		}
+	}
+}
+
+// peek is Get for the map's own use: it doesn't count as an access for
+// WithAccessTracking.
+func (m *Map) peek(key uint64) (uint64, bool) {
+	if key == FREE_KEY {
+		return m.freeVal, m.hasFreeKey
+	}
+	if ptr, ok := m.lookup(key); ok {
+		return m.data[ptr+1], true
+	}
+	return 0, false
+}
+
+// putNew stores a new non-zero key at the free slot ptr returned by lookup,
+// growing the map if needed.
+func (m *Map) putNew(ptr, key, val uint64) {
+	if m.hooked {
+		m.onPut(ptr, key, 0, val, false)
+	}
+	m.data[ptr] = key
+	m.data[ptr+1] = val
+	if m.size >= m.threshold {
+		m.rehash()
+	} else {
+		m.size++
+	}
+}
+
 // Put adds or updates key with value val.
 func (m *Map) Put(key uint64, val uint64) {
+	if m.shrinkDue {
+		m.maybeShrink()
+	}
 	if key == FREE_KEY {
+		if m.hooked {
+			m.onPut(0, key, m.freeVal, val, m.hasFreeKey)
+		}
 		if !m.hasFreeKey {
 			m.size++
 		}
@@ -118,10 +309,17 @@ func (m *Map) Put(key uint64, val uint64) {
 		return
 	}
 
+	if m.hash != nil {
+		m.putHashed(key, val)
+		return
+	}
 	ptr := (phiMix(key) & m.mask) << 1
 	k := m.data[ptr]
 
 	if k == FREE_KEY { // end of chain already
+		if m.hooked {
+			m.onPut(ptr, key, 0, val, false)
+		}
 		m.data[ptr] = key
 		m.data[ptr+1] = val
 		if m.size >= m.threshold {
@@ -131,15 +329,26 @@ func (m *Map) Put(key uint64, val uint64) {
 		}
 		return
 	} else if k == key { // overwrite existed value
+		if m.hooked {
+			m.onPut(ptr, key, m.data[ptr+1], val, true)
+		}
 		m.data[ptr+1] = val
 		return
 	}
 
+	var probes int
 	for {
 		ptr = (ptr + 2) & m.mask2
+		if probeGuard {
+			probes++
+			m.checkProbes("Put", key, probes)
+		}
 		k = m.data[ptr]
 
 		if k == FREE_KEY {
+			if m.hooked {
+				m.onPut(ptr, key, 0, val, false)
+			}
 			m.data[ptr] = key
 			m.data[ptr+1] = val
 			if m.size >= m.threshold {
@@ -149,6 +358,9 @@ func (m *Map) Put(key uint64, val uint64) {
 			}
 			return
 		} else if k == key {
+			if m.hooked {
+				m.onPut(ptr, key, m.data[ptr+1], val, true)
+			}
 			m.data[ptr+1] = val
 			return
 		}
@@ -156,32 +368,124 @@ func (m *Map) Put(key uint64, val uint64) {
 
 }
 
+// PutIf stores val under key only if cond(old, exists) returns true, where
+// old is the current value of key and exists whether it is present (old is
+// 0 if not), and reports whether it stored. The key is looked up once for
+// both the test and the write. cond must not modify m.
+func (m *Map) PutIf(key, val uint64, cond func(old uint64, exists bool) bool) bool {
+	if key == FREE_KEY {
+		var old uint64
+		if m.hasFreeKey {
+			old = m.freeVal
+		}
+		if !cond(old, m.hasFreeKey) {
+			return false
+		}
+		m.Put(FREE_KEY, val)
+		return true
+	}
+
+	ptr, ok := m.lookup(key)
+	if !ok {
+		if !cond(0, false) {
+			return false
+		}
+		m.putNew(ptr, key, val)
+		return true
+	}
+	if !cond(m.data[ptr+1], true) {
+		return false
+	}
+	if m.hooked {
+		m.onPut(ptr, key, m.data[ptr+1], val, true)
+	}
+	m.data[ptr+1] = val
+	return true
+}
+
+// Replace stores val under key only if key is present, never inserting, and
+// returns the previous value and whether it replaced it. An absent key
+// leaves the map unchanged.
+func (m *Map) Replace(key, val uint64) (old uint64, replaced bool) {
+	if key == FREE_KEY {
+		if !m.hasFreeKey {
+			return 0, false
+		}
+		old = m.freeVal
+		m.Put(FREE_KEY, val)
+		return old, true
+	}
+
+	ptr, ok := m.lookup(key)
+	if !ok {
+		return 0, false
+	}
+	old = m.data[ptr+1]
+	if m.hooked {
+		m.onPut(ptr, key, old, val, true)
+	}
+	m.data[ptr+1] = val
+	return old, true
+}
+
 // Del deletes a key and its value.
 func (m *Map) Del(key uint64) {
+	if m.shrinkDue {
+		m.maybeShrink()
+	}
 	if key == FREE_KEY {
-		m.hasFreeKey = false
-		m.size--
+		if m.hasFreeKey {
+			if m.hooked {
+				m.onDel(key, m.freeVal)
+			}
+			m.hasFreeKey = false
+			m.size--
+			if m.shrinkLoad > 0 {
+				m.maybeShrink()
+			}
+		}
 		return
 	}
 
+	if m.hash != nil {
+		m.delHashed(key)
+		return
+	}
 	ptr := (phiMix(key) & m.mask) << 1
 	k := m.data[ptr]
 
 	if k == key {
+		if m.hooked {
+			m.onDel(key, m.data[ptr+1])
+		}
 		m.shiftKeys(ptr)
 		m.size--
+		if m.shrinkLoad > 0 {
+			m.maybeShrink()
+		}
 		return
 	} else if k == FREE_KEY { // end of chain already
 		return
 	}
 
+	var probes int
 	for {
 		ptr = (ptr + 2) & m.mask2
+		if probeGuard {
+			probes++
+			m.checkProbes("Del", key, probes)
+		}
 		k = m.data[ptr]
 
 		if k == key {
+			if m.hooked {
+				m.onDel(key, m.data[ptr+1])
+			}
 			m.shiftKeys(ptr)
 			m.size--
+			if m.shrinkLoad > 0 {
+				m.maybeShrink()
+			}
 			return
 		} else if k == FREE_KEY {
 			return
@@ -190,6 +494,51 @@ func (m *Map) Del(key uint64) {
 	}
 }
 
+// checkProbes panics if a probe sequence for key has visited every slot
+// without finding the key or a free slot. It is only called when probeGuard
+// is enabled.
+func (m *Map) checkProbes(op string, key uint64, probes int) {
+	if probes >= len(m.data)/2 {
+		panic(fmt.Sprintf("intintmap: %s(%d) probed all %d slots without finding a free one (size %d, threshold %d); the map is corrupt",
+			op, key, len(m.data)/2, m.size, m.threshold))
+	}
+}
+
+// Rename moves the value of oldKey to newKey, deleting oldKey. It returns
+// false and leaves the map unchanged if oldKey is absent or newKey is already
+// present; renaming a present key to itself returns true and does nothing.
+func (m *Map) Rename(oldKey, newKey uint64) bool {
+	if oldKey == newKey {
+		_, ok := m.peek(oldKey)
+		return ok
+	}
+	if _, ok := m.peek(newKey); ok {
+		return false
+	}
+
+	var val uint64
+	if oldKey == FREE_KEY {
+		if !m.hasFreeKey {
+			return false
+		}
+		val = m.freeVal
+		m.hasFreeKey = false
+	} else {
+		ptr, ok := m.lookup(oldKey)
+		if !ok {
+			return false
+		}
+		val = m.data[ptr+1]
+		m.shiftKeys(ptr)
+	}
+	if m.hooked {
+		m.onDel(oldKey, val)
+	}
+	m.size--
+	m.Put(newKey, val)
+	return true
+}
+
 func (m *Map) shiftKeys(pos uint64) uint64 {
 	// Shift entries with the same hash.
 	var last, slot uint64
@@ -205,7 +554,7 @@ func (m *Map) shiftKeys(pos uint64) uint64 {
 				return last
 			}
 
-			slot = (phiMix(k) & m.mask) << 1
+			slot = (m.mix(k) & m.mask) << 1
 			if last <= pos {
 				if last >= slot || slot > pos {
 					break
@@ -219,32 +568,276 @@ func (m *Map) shiftKeys(pos uint64) uint64 {
 		}
 		data[last] = k
 		data[last+1] = data[pos+1]
+		if m.seqs != nil {
+			m.seqs[last>>1] = m.seqs[pos>>1]
+		}
+		if m.hits != nil {
+			m.hits[last>>1] = m.hits[pos>>1]
+		}
+	}
+}
+
+// update calls fn for every entry, storing the value it returns or deleting
+// the entry if del is true. Deletion shifts later entries of a chain back
+// into the vacated slot, so the scan starts just past a free slot (no chain
+// wraps across it) and re-examines a slot after deleting from it; this way
+// every entry is visited exactly once.
+func (m *Map) update(fn func(key, val uint64) (newVal uint64, del bool)) {
+	if m.hasFreeKey {
+		v, del := fn(FREE_KEY, m.freeVal)
+		if del {
+			if m.hooked {
+				m.onDel(FREE_KEY, m.freeVal)
+			}
+			m.hasFreeKey = false
+			m.size--
+		} else {
+			if m.hooked && v != m.freeVal {
+				m.onPut(0, FREE_KEY, m.freeVal, v, true)
+			}
+			m.freeVal = v
+		}
+	}
+
+	var ptr uint64
+	for m.data[ptr] != FREE_KEY { // there is always at least one free slot
+		ptr += 2
+	}
+
+	var k, v uint64
+	var del bool
+	for n := len(m.data) / 2; n > 0; n-- {
+		ptr = (ptr + 2) & m.mask2
+		for {
+			k = m.data[ptr]
+			if k == FREE_KEY {
+				break
+			}
+			if v, del = fn(k, m.data[ptr+1]); !del {
+				if m.hooked && v != m.data[ptr+1] {
+					m.onPut(ptr, k, m.data[ptr+1], v, true)
+				}
+				m.data[ptr+1] = v
+				break
+			}
+			if m.hooked {
+				m.onDel(k, m.data[ptr+1])
+			}
+			m.shiftKeys(ptr)
+			m.size--
+		}
+	}
+	if m.shrinkLoad > 0 {
+		m.maybeShrink()
 	}
 }
 
 func (m *Map) rehash() {
-	newCapacity := len(m.data) * 2
-	m.threshold = int(math.Floor(float64(newCapacity/2) * m.fillFactor))
-	m.mask = uint64(newCapacity/2 - 1)
-	m.mask2 = uint64(newCapacity - 1)
+	m.resize(len(m.data)) // len(m.data) is twice the slot count
+}
+
+// resize rebuilds the table with the given number of slots, which must be a
+// power of two, reinserting every entry. Every resize restarts the cooldown.
+func (m *Map) resize(slots int) {
+	data, seqs, hits := m.data, m.seqs, m.hits // original data
+	m.alloc(slots)
+	m.stampRehash()
+
+	var o, ptr uint64
+	for i := 0; i < len(data); i += 2 {
+		o = data[i]
+		if o != FREE_KEY {
+			ptr = m.insert(o, data[i+1])
+			if seqs != nil {
+				m.seqs[ptr>>1] = seqs[i>>1]
+			}
+			if hits != nil {
+				m.hits[ptr>>1] = hits[i>>1]
+			}
+		}
+	}
+}
 
-	data := make([]uint64, len(m.data)) // copy of original data
-	copy(data, m.data)
+// alloc replaces the table with an empty one of the given number of slots,
+// which must be a power of two, keeping only the free key.
+func (m *Map) alloc(slots int) {
+	m.threshold = int(math.Floor(float64(slots) * m.fillFactor))
+	m.mask = uint64(slots - 1)
+	m.mask2 = uint64(2*slots - 1)
 
-	m.data = make([]uint64, newCapacity)
+	m.data = make([]uint64, 2*slots)
+	if m.tracked {
+		m.seqs = make([]uint64, slots)
+	}
+	if m.counted {
+		m.hits = make([]uint64, slots)
+	}
 	if m.hasFreeKey { // reset size
 		m.size = 1
 	} else {
 		m.size = 0
 	}
+}
 
-	var o uint64
+// insert stores a non-zero key known to be absent into a table with room
+// for it, returning its position in data. It neither grows the map nor
+// calls the option hooks.
+func (m *Map) insert(key, val uint64) uint64 {
+	if m.hash != nil {
+		return m.insertHashed(key, val)
+	}
+	ptr := (phiMix(key) & m.mask) << 1
+	for m.data[ptr] != FREE_KEY {
+		ptr = (ptr + 2) & m.mask2
+	}
+	m.data[ptr] = key
+	m.data[ptr+1] = val
+	m.size++
+	return ptr
+}
+
+// insertAt stores a new non-zero key at the free slot ptr returned by
+// lookup. Like insert, it neither grows the map nor calls the option hooks.
+func (m *Map) insertAt(ptr, key, val uint64) {
+	m.data[ptr] = key
+	m.data[ptr+1] = val
+	m.size++
+}
+
+// SetAll replaces the contents of the map with keys[i] -> vals[i], later
+// duplicates winning. It reuses the backing array if it is big enough and
+// otherwise allocates one sized for len(keys), so it never rehashes.
+func (m *Map) SetAll(keys, vals []uint64) {
+	if len(keys) != len(vals) {
+		panic("Keys and vals must have equal lengths")
+	}
+
+	if m.tracked { // log the old keys as deleted by the reset to come
+		m.each(func(k, _ uint64) bool {
+			m.dels = append(m.dels, [2]uint64{m.version + 1, k})
+			return true
+		})
+	}
+	m.hasFreeKey = false
+	m.freeVal = 0
+	if slots := arraySize(len(keys), m.fillFactor); slots > len(m.data)/2 {
+		m.alloc(slots)
+	} else {
+		for i := range m.data {
+			m.data[i] = 0
+		}
+		m.size = 0
+	}
+	m.stampRehash()
+
+	for i, k := range keys {
+		if k == FREE_KEY {
+			if !m.hasFreeKey {
+				m.size++
+			}
+			m.hasFreeKey = true
+			m.freeVal = vals[i]
+		} else if ptr, ok := m.lookup(k); ok {
+			m.data[ptr+1] = vals[i]
+		} else {
+			m.insertAt(ptr, k, vals[i])
+		}
+	}
+	m.resetHooks()
+}
+
+// Data returns the backing array, which interleaves keys (even indexes) and
+// values (odd indexes); a key of 0 marks a free slot, and the free key itself
+// is not stored in it. Callers may fill slots directly, ignoring the probe
+// order, as long as they call Reindex before using the map again. The slice
+// is only valid until the next operation that may grow the map.
+func (m *Map) Data() []uint64 {
+	return m.data
+}
+
+// Reindex rebuilds the probe structure from the current contents of the
+// backing array, recomputing the size and moving every entry to its proper
+// position. If a key occupies several slots, the value in the highest slot
+// wins. The map grows if the array holds more entries than its threshold.
+// With WithChangeTracking, Reindex discards the deletion log as TrimChanges
+// would, since it can't tell which keys were cleared through Data.
+func (m *Map) Reindex() {
+	data := m.data
+	n := 0
 	for i := 0; i < len(data); i += 2 {
-		o = data[i]
-		if o != FREE_KEY {
-			m.Put(o, data[i+1])
+		if data[i] != FREE_KEY {
+			n++
 		}
 	}
+	slots := len(data) / 2
+	if n > m.threshold {
+		slots = arraySize(n, m.fillFactor)
+	}
+
+	m.alloc(slots)
+	m.stampRehash()
+	var k uint64
+	for i := 0; i < len(data); i += 2 {
+		k = data[i]
+		if k == FREE_KEY {
+			continue
+		}
+		if ptr, ok := m.lookup(k); ok {
+			m.data[ptr+1] = data[i+1]
+		} else {
+			m.insertAt(ptr, k, data[i+1])
+		}
+	}
+	m.resetHooks()
+	if m.tracked { // keys cleared through Data can't be told apart
+		m.dels = nil
+		m.trimmed = m.version
+	}
+}
+
+// Release zeroes the backing array and returns it, for example to put in a
+// sync.Pool and hand to NewFromPool later. The map is left empty and must
+// not be used again; the behaviour of any further call on it is undefined.
+func (m *Map) Release() []uint64 {
+	data := m.data
+	for i := range data {
+		data[i] = 0
+	}
+	m.data = nil
+	m.seqs = nil
+	m.hits = nil
+	m.size = 0
+	m.hasFreeKey = false
+	m.freeVal = 0
+	return data
+}
+
+// Clone returns a deep copy of the map.
+func (m *Map) Clone() *Map {
+	c := *m
+	c.data = make([]uint64, len(m.data))
+	copy(c.data, m.data)
+	if m.seqs != nil {
+		c.seqs = make([]uint64, len(m.seqs))
+		copy(c.seqs, m.seqs)
+	}
+	if m.hits != nil {
+		c.hits = make([]uint64, len(m.hits))
+		copy(c.hits, m.hits)
+	}
+	c.dels = append([][2]uint64(nil), m.dels...)
+	return &c
+}
+
+// SetMeta attaches an opaque value to the map. It plays no part in hashing,
+// comparisons or serialization, and Clone copies it shallowly.
+func (m *Map) SetMeta(v any) {
+	m.meta = v
+}
+
+// Meta returns the value set with SetMeta, or nil.
+func (m *Map) Meta() any {
+	return m.meta
 }
 
 // Size returns size of the map.
@@ -252,6 +845,75 @@ func (m *Map) Size() int {
 	return m.size
 }
 
+// FitsWithoutRehash reports whether extra more new non-zero keys can be
+// inserted without triggering a rehash. A Put of a new key rehashes when the
+// size before the insertion has reached the threshold, so this holds exactly
+// when Size()+extra stays at or below it. The free key (0) is stored outside
+// the table and never triggers a rehash, but it does count toward Size().
+func (m *Map) FitsWithoutRehash(extra int) bool {
+	return extra <= 0 || m.size+extra <= m.threshold
+}
+
+// Reserve grows the map, if needed, so that extra more new keys can be
+// inserted without a rehash.
+func (m *Map) Reserve(extra int) {
+	if !m.FitsWithoutRehash(extra) {
+		m.resize(arraySize(m.size+extra, m.fillFactor))
+	}
+}
+
+// ReserveFromHistogram reserves room for the sum of counts new keys, such as
+// the expected sizes of the categories a staged build will insert, so the
+// whole build rehashes at most once. It panics on a negative count.
+func (m *Map) ReserveFromHistogram(counts []int) {
+	total := 0
+	for _, n := range counts {
+		if n < 0 {
+			panic("Counts must not be negative")
+		}
+		total += n
+	}
+	m.Reserve(total)
+}
+
+// ReserveForLoad resizes the table so that once it holds entries entries
+// its load factor is about targetLoad, which is clamped into [0.01, 0.99].
+// A target below the map's fill factor trades memory for shorter probe
+// chains; a target above it is capped by the fill factor, which still
+// decides when the map grows. Existing entries are migrated once.
+func (m *Map) ReserveForLoad(entries int, targetLoad float64) {
+	targetLoad = math.Min(math.Max(targetLoad, 0.01), 0.99)
+	if entries < m.size {
+		entries = m.size
+	}
+	if entries < 1 {
+		entries = 1
+	}
+
+	slots := arraySize(entries, targetLoad)
+	if need := arraySize(entries, m.fillFactor); slots < need {
+		slots = need
+	}
+	if slots != len(m.data)/2 {
+		m.resize(slots)
+	}
+}
+
+// RehashThreshold returns the size and load factor (size over slot count) at
+// which the map grows: inserting a new non-zero key while Size() is at least
+// atSize rehashes into twice the slots. Both change after every rehash. The
+// free key is stored outside the table and inserting it never triggers a
+// rehash, but it is included in Size() and so counts toward atSize.
+func (m *Map) RehashThreshold() (atSize int, atLoad float64) {
+	return m.threshold, float64(m.threshold) / float64(len(m.data)/2)
+}
+
+// MemoryBytes returns the size in bytes of the map's backing array, which
+// dominates its memory use.
+func (m *Map) MemoryBytes() int {
+	return 8 * len(m.data)
+}
+
 // Keys returns a channel for iterating all keys.
 func (m *Map) Keys() chan uint64 {
 	c := make(chan uint64, 10)
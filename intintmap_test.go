@@ -253,3 +253,453 @@ func BenchmarkStdMapGet100PercentHitRate(b *testing.B) {
 		//log.Println("map sum:", sum)
 	}
 }
+
+func TestFitsWithoutRehash(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 1; ; i++ {
+		fits := m.FitsWithoutRehash(1)
+		capacity := len(m.data)
+		m.Put(i, i)
+		if rehashed := len(m.data) != capacity; rehashed == fits {
+			t.Fatalf("FitsWithoutRehash(1) = %v at size %d, but rehashed = %v", fits, m.Size()-1, rehashed)
+		}
+		if i > 100 {
+			break
+		}
+	}
+	if !m.FitsWithoutRehash(0) {
+		t.Errorf("expected zero extra keys to always fit")
+	}
+}
+
+func FuzzReindex(f *testing.F) {
+	f.Add([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9})
+	f.Add([]byte{0, 0, 0, 255, 255, 255, 1, 1, 1})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		m := New(16, 0.6)
+		m.Put(0, 42)
+		data := m.Data()
+		for i := 0; i+2 < len(b); i += 3 {
+			ptr := (int(b[i]) * 2) % len(data)
+			data[ptr] = uint64(b[i+1])
+			data[ptr+1] = uint64(b[i+2])
+		}
+
+		want := map[uint64]uint64{0: 42}
+		for i := 0; i < len(data); i += 2 {
+			if data[i] != FREE_KEY {
+				want[data[i]] = data[i+1]
+			}
+		}
+
+		m.Reindex()
+		if m.Size() != len(want) {
+			t.Errorf("size (%d) is not right, should be %d", m.Size(), len(want))
+		}
+		for k, v := range want {
+			if got, ok := m.Get(k); !ok || got != v {
+				t.Errorf("expected %d as value for key %d, got %d", v, k, got)
+			}
+		}
+		n := 0
+		for range m.Keys() {
+			n++
+		}
+		if n != len(want) {
+			t.Errorf("iterated %d keys, expected %d", n, len(want))
+		}
+	})
+}
+
+func TestRehashThreshold(t *testing.T) {
+	m := New(100, 0.75)
+	atSize, atLoad := m.RehashThreshold()
+	if atLoad > 0.75 || atLoad < 0.74 {
+		t.Errorf("load factor (%f) is not right, should be about 0.75", atLoad)
+	}
+
+	var i uint64
+	for i = 1; m.Size() < atSize; i++ {
+		m.Put(i, i)
+	}
+	capacity := len(m.data)
+	m.Put(i, i)
+	if len(m.data) != 2*capacity {
+		t.Errorf("expected a rehash when inserting at size %d", atSize)
+	}
+	if next, _ := m.RehashThreshold(); next <= atSize {
+		t.Errorf("threshold (%d) didn't grow after rehash, was %d", next, atSize)
+	}
+}
+
+func TestRename(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 1; i < 1000; i++ {
+		m.Put(i, i*10)
+	}
+
+	if !m.Rename(5, 0) {
+		t.Errorf("expected rename of 5 to free key to succeed")
+	}
+	if v, ok := m.Get(0); !ok || v != 50 {
+		t.Errorf("expected 50 as value for key 0, got %d", v)
+	}
+	if _, ok := m.Get(5); ok {
+		t.Errorf("didn't expect renamed key 5 to be present")
+	}
+
+	if !m.Rename(0, 5000) {
+		t.Errorf("expected rename of free key to 5000 to succeed")
+	}
+	if v, ok := m.Get(5000); !ok || v != 50 {
+		t.Errorf("expected 50 as value for key 5000, got %d", v)
+	}
+	if _, ok := m.Get(0); ok {
+		t.Errorf("didn't expect renamed free key to be present")
+	}
+
+	if m.Rename(0, 7) || m.Rename(6, 7) || m.Rename(1<<40, 1<<41) {
+		t.Errorf("expected renames from absent or to present keys to fail")
+	}
+	if v, ok := m.Get(6); !ok || v != 60 {
+		t.Errorf("expected failed rename to leave key 6 alone, got %d", v)
+	}
+
+	if m.Size() != 999 {
+		t.Errorf("size (%d) is not right, should be 999", m.Size())
+	}
+	for i = 1; i < 1000; i++ {
+		if i == 5 {
+			continue
+		}
+		if v, ok := m.Get(i); !ok || v != i*10 {
+			t.Errorf("expected %d as value for key %d, got %d", i*10, i, v)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	m := New(10, 0.6)
+	m.Put(0, 1)
+	m.Put(1, 1)
+	m.Reserve(1000)
+	if !m.FitsWithoutRehash(1000) {
+		t.Errorf("expected 1000 more keys to fit after Reserve(1000)")
+	}
+	capacity := len(m.data)
+	var i uint64
+	for i = 2; i < 1002; i++ {
+		m.Put(i, i)
+	}
+	if len(m.data) != capacity {
+		t.Errorf("didn't expect a rehash after Reserve")
+	}
+	if v, ok := m.Get(1); !ok || v != 1 {
+		t.Errorf("expected Reserve to keep existing entries")
+	}
+}
+
+func TestMeta(t *testing.T) {
+	m := New(10, 0.6)
+	if m.Meta() != nil {
+		t.Errorf("expected no metadata on a new map")
+	}
+	m.SetMeta("v1")
+	m.Put(1, 1)
+
+	c := m.Clone()
+	if c.Meta() != "v1" {
+		t.Errorf("expected Clone to copy metadata, got %v", c.Meta())
+	}
+	c.SetMeta("v2")
+	if m.Meta() != "v1" {
+		t.Errorf("expected SetMeta on a clone to leave the original alone")
+	}
+
+	b, _ := m.MarshalBinary()
+	n := New(10, 0.6)
+	if err := n.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if n.Meta() != nil {
+		t.Errorf("didn't expect metadata to be serialized")
+	}
+}
+
+func TestReserveForLoad(t *testing.T) {
+	m := New(10, 0.75)
+	m.Put(0, 1)
+	m.Put(1, 1)
+	m.ReserveForLoad(1000, 0.4)
+	capacity := len(m.data)
+	var i uint64
+	for i = 2; i < 1000; i++ {
+		m.Put(i, i)
+	}
+	if len(m.data) != capacity {
+		t.Errorf("didn't expect a rehash after ReserveForLoad")
+	}
+	if load := float64(m.Size()) / float64(len(m.data)/2); load > 0.4 || load < 0.2 {
+		t.Errorf("load factor (%f) is not right, should be at most 0.4", load)
+	}
+	if v, ok := m.Get(1); !ok || v != 1 {
+		t.Errorf("expected ReserveForLoad to keep existing entries")
+	}
+
+	m.ReserveForLoad(1000, 2)
+	if load := float64(m.Size()) / float64(len(m.data)/2); load > 0.75 {
+		t.Errorf("load factor (%f) exceeds the fill factor", load)
+	}
+}
+
+func TestReleaseAndNewFromPool(t *testing.T) {
+	m := New(1000, 0.6)
+	var i uint64
+	for i = 0; i < 1000; i++ {
+		m.Put(i, i)
+	}
+	buf := m.Release()
+	for _, x := range buf {
+		if x != 0 {
+			t.Fatalf("expected Release to zero the backing array")
+		}
+	}
+
+	n := NewFromPool(buf, 0.6)
+	if len(n.data) != len(buf) {
+		t.Errorf("expected the whole buffer to be adopted")
+	}
+	if n.Size() != 0 {
+		t.Errorf("size (%d) is not right, should be 0", n.Size())
+	}
+	for i = 1; i < 3000; i++ {
+		n.Put(i, i*2)
+	}
+	for i = 1; i < 3000; i++ {
+		if v, ok := n.Get(i); !ok || v != i*2 {
+			t.Errorf("expected %d as value for key %d, got %d", i*2, i, v)
+		}
+	}
+	if _, ok := n.Get(0); ok {
+		t.Errorf("didn't expect the free key in a map from the pool")
+	}
+}
+
+func TestSetAll(t *testing.T) {
+	m := New(10, 0.6, WithRunningChecksum())
+	var i uint64
+	for i = 0; i < 100; i++ {
+		m.Put(i, i)
+	}
+
+	keys := []uint64{0, 200, 300, 200, 0}
+	vals := []uint64{1, 2, 3, 4, 5}
+	m.SetAll(keys, vals)
+	if m.Size() != 3 {
+		t.Errorf("size (%d) is not right, should be 3", m.Size())
+	}
+	for k, want := range map[uint64]uint64{0: 5, 200: 4, 300: 3} {
+		if v, ok := m.Get(k); !ok || v != want {
+			t.Errorf("expected %d as value for key %d, got %d", want, k, v)
+		}
+	}
+	if _, ok := m.Get(1); ok {
+		t.Errorf("didn't expect old key 1 after SetAll")
+	}
+	if m.RunningChecksum() != m.Checksum() {
+		t.Errorf("running checksum diverged after SetAll")
+	}
+
+	keys, vals = make([]uint64, 10000), make([]uint64, 10000)
+	for j := range keys {
+		keys[j], vals[j] = uint64(j)+1, uint64(j)
+	}
+	m.SetAll(keys, vals)
+	for j := range keys {
+		if v, ok := m.Get(keys[j]); !ok || v != vals[j] {
+			t.Errorf("expected %d as value for key %d, got %d", vals[j], keys[j], v)
+		}
+	}
+}
+
+func benchmarkSetAllData() (keys, vals []uint64) {
+	keys, vals = make([]uint64, 100000), make([]uint64, 100000)
+	for j := range keys {
+		keys[j], vals[j] = uint64(j)*STEP, uint64(j)
+	}
+	return keys, vals
+}
+
+func BenchmarkSetAll(b *testing.B) {
+	keys, vals := benchmarkSetAllData()
+	m := New(2048, 0.60)
+	for i := 0; i < b.N; i++ {
+		m.SetAll(keys, vals)
+	}
+}
+
+func BenchmarkNewAndPut(b *testing.B) {
+	keys, vals := benchmarkSetAllData()
+	for i := 0; i < b.N; i++ {
+		m := New(2048, 0.60)
+		for j, k := range keys {
+			m.Put(k, vals[j])
+		}
+	}
+}
+
+func TestGetPtr(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 100; i++ {
+		m.Put(i, i)
+	}
+	for i = 0; i < 100; i++ {
+		if p := m.GetPtr(i); p != nil {
+			*p += 1000
+		} else {
+			t.Errorf("expected a pointer for key %d", i)
+		}
+	}
+	for i = 0; i < 100; i++ {
+		if v, ok := m.Get(i); !ok || v != i+1000 {
+			t.Errorf("expected %d as value for key %d, got %d", i+1000, i, v)
+		}
+	}
+	if m.GetPtr(1000) != nil {
+		t.Errorf("expected nil for an absent key")
+	}
+	m.Del(0)
+	if m.GetPtr(0) != nil {
+		t.Errorf("expected nil for an absent free key")
+	}
+}
+
+func TestGetPtrObservers(t *testing.T) {
+	m := New(10, 0.6, WithRunningMinMax())
+	var i uint64
+	for i = 1; i <= 100; i++ {
+		m.Put(i, i)
+	}
+	*m.GetPtr(50) = 1000
+	*m.GetPtr(1) = 500
+	if lo, hi, ok := m.MinMax(); !ok || lo != 2 || hi != 1000 {
+		t.Errorf("expected range [2, 1000], got [%d, %d]", lo, hi)
+	}
+
+	for _, opt := range []Option{WithRunningChecksum(), WithChangeTracking()} {
+		m := New(10, 0.6, opt)
+		m.Put(1, 1)
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected GetPtr to panic on a map whose changes are observed")
+				}
+			}()
+			m.GetPtr(1)
+		}()
+	}
+}
+
+func TestReserveFromHistogram(t *testing.T) {
+	m := New(10, 0.6)
+	m.ReserveFromHistogram([]int{100, 0, 250})
+	if !m.FitsWithoutRehash(350) {
+		t.Errorf("expected 350 more keys to fit")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for a negative count")
+		}
+	}()
+	m.ReserveFromHistogram([]int{1, -1})
+}
+
+func TestPutIf(t *testing.T) {
+	m := New(10, 0.6)
+	greater := func(val uint64) func(uint64, bool) bool {
+		return func(old uint64, exists bool) bool { return !exists || val > old }
+	}
+
+	var i uint64
+	for i = 0; i < 100; i++ {
+		if !m.PutIf(i, i*2, greater(i*2)) {
+			t.Errorf("expected key %d to be inserted", i)
+		}
+	}
+	if m.Size() != 100 {
+		t.Errorf("size (%d) is not right, should be %d", m.Size(), 100)
+	}
+	for i = 0; i < 100; i++ {
+		if i%2 == 0 {
+			if !m.PutIf(i, i*3, greater(i*3)) && i != 0 {
+				t.Errorf("expected key %d to be overwritten", i)
+			}
+		} else if m.PutIf(i, i, greater(i)) {
+			t.Errorf("expected key %d not to be overwritten", i)
+		}
+	}
+	for i = 0; i < 100; i++ {
+		want := i * 2
+		if i%2 == 0 {
+			want = i * 3
+		}
+		if v, ok := m.Get(i); !ok || v != want {
+			t.Errorf("expected %d as value for key %d, got %d", want, i, v)
+		}
+	}
+
+	if m.PutIf(1000, 1, func(uint64, bool) bool { return false }) {
+		t.Errorf("expected the insert to be rejected")
+	}
+	if _, ok := m.Get(1000); ok || m.Size() != 100 {
+		t.Errorf("rejected insert changed the map")
+	}
+
+	m.Del(0)
+	var sawExists bool
+	m.PutIf(0, 5, func(_ uint64, exists bool) bool { sawExists = exists; return true })
+	if sawExists {
+		t.Errorf("expected the absent free key to be reported absent")
+	}
+	m.PutIf(0, 7, func(old uint64, exists bool) bool { return exists && old == 5 })
+	if v, _ := m.Get(0); v != 7 {
+		t.Errorf("expected %d as value for key %d, got %d", 7, 0, v)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	m := New(10, 0.6, WithRunningChecksum())
+	var i uint64
+	for i = 0; i < 100; i++ {
+		m.Put(i, i)
+	}
+
+	for i = 0; i < 100; i++ {
+		if old, ok := m.Replace(i, i+1000); !ok || old != i {
+			t.Errorf("expected to replace %d for key %d, got %d (%v)", i, i, old, ok)
+		}
+	}
+	for i = 0; i < 100; i++ {
+		if v, ok := m.Get(i); !ok || v != i+1000 {
+			t.Errorf("expected %d as value for key %d, got %d", i+1000, i, v)
+		}
+	}
+
+	m.Del(0)
+	sum := m.RunningChecksum()
+	for _, k := range []uint64{0, 100, 1 << 40} {
+		if old, ok := m.Replace(k, 1); ok || old != 0 {
+			t.Errorf("expected no replacement for absent key %d, got %d (%v)", k, old, ok)
+		}
+		if _, ok := m.Get(k); ok {
+			t.Errorf("Replace inserted absent key %d", k)
+		}
+	}
+	if m.Size() != 99 || m.RunningChecksum() != sum {
+		t.Errorf("Replace of absent keys changed the map")
+	}
+}
@@ -0,0 +1,85 @@
+package intintmap
+
+// Option configures optional behaviour of a Map; pass options to New.
+type Option func(*Map)
+
+// onPut is called by every mutation that stores val under key while an
+// option needs to observe changes; old is the previous value if existed, and
+// ptr is the position of key in data unless key is the free key.
+func (m *Map) onPut(ptr, key, old, val uint64, existed bool) {
+	if m.checksummed {
+		if existed {
+			m.checksum ^= pairHash(key, old)
+		}
+		m.checksum ^= pairHash(key, val)
+	}
+	if m.tracked {
+		m.version++
+		if key == FREE_KEY {
+			m.freeSeq = m.version
+		} else {
+			m.seqs[ptr>>1] = m.version
+		}
+	}
+	if m.counted && !existed { // a new key starts unaccessed
+		if key == FREE_KEY {
+			m.freeHits = 0
+		} else {
+			m.hits[ptr>>1] = 0
+		}
+	}
+	if m.ranged && !m.rangeStale {
+		switch {
+		case !existed && m.size == 0: // the first entry
+			m.minVal, m.maxVal = val, val
+		case existed && (old == m.minVal && val > old || old == m.maxVal && val < old):
+			m.rangeStale = true // an extreme moved inwards
+		default:
+			if val < m.minVal {
+				m.minVal = val
+			}
+			if val > m.maxVal {
+				m.maxVal = val
+			}
+		}
+	}
+}
+
+// onDel is called by every mutation that removes key, holding val, while an
+// option needs to observe changes.
+func (m *Map) onDel(key, val uint64) {
+	if m.checksummed {
+		m.checksum ^= pairHash(key, val)
+	}
+	if m.tracked {
+		m.version++
+		m.dels = append(m.dels, [2]uint64{m.version, key})
+	}
+	if m.ranged && (val == m.minVal || val == m.maxVal) {
+		m.rangeStale = true
+	}
+}
+
+// resetHooks recomputes the state kept by options from the map's contents,
+// after the entries were changed without going through onPut and onDel.
+func (m *Map) resetHooks() {
+	if m.checksummed {
+		m.checksum = m.Checksum()
+	}
+	if m.tracked { // everything may have changed
+		m.version++
+		m.freeSeq = m.version
+		for i := range m.seqs {
+			m.seqs[i] = m.version
+		}
+	}
+	if m.ranged {
+		m.rangeStale = true
+	}
+	if m.counted {
+		m.freeHits = 0
+		for i := range m.hits {
+			m.hits[i] = 0
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package intintmap
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// keys returns a new slice of all keys, the free key included.
+func (m *Map) keys() []uint64 {
+	keys := make([]uint64, 0, m.Size())
+	m.each(func(k, _ uint64) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys
+}
+
+// SortedKeys returns all keys in ascending order.
+func (m *Map) SortedKeys() []uint64 {
+	keys := m.keys()
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+// NthKey returns the nth smallest key, counting from 0 and including the
+// free key; ok is false if n is out of range. It runs quickselect over a copy
+// of the keys, taking O(size) time on average, so several order statistics
+// of the same map are better read from one SortedKeys call.
+func (m *Map) NthKey(n int) (key uint64, ok bool) {
+	if n < 0 || n >= m.Size() {
+		return 0, false
+	}
+	return selectNth(m.keys(), n), true
+}
+
+// selectNth reorders a and returns its nth smallest element, counting from
+// 0, using quickselect with a median-of-three pivot.
+func selectNth(a []uint64, n int) uint64 {
+	lo, hi := 0, len(a)-1
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		if a[mid] < a[lo] {
+			a[mid], a[lo] = a[lo], a[mid]
+		}
+		if a[hi] < a[lo] {
+			a[hi], a[lo] = a[lo], a[hi]
+		}
+		if a[hi] < a[mid] {
+			a[hi], a[mid] = a[mid], a[hi]
+		}
+		pivot := a[mid]
+
+		i, j := lo, hi
+		for i <= j {
+			for a[i] < pivot {
+				i++
+			}
+			for a[j] > pivot {
+				j--
+			}
+			if i <= j {
+				a[i], a[j] = a[j], a[i]
+				i++
+				j--
+			}
+		}
+		switch {
+		case n <= j:
+			hi = j
+		case n >= i:
+			lo = i
+		default:
+			return a[n]
+		}
+	}
+	return a[n]
+}
+
+// DensifyKeys renumbers the keys as 0..Size()-1 in ascending key order, the
+// free key included. dense maps each new id to the value of its original key
+// and mapping maps each original key to its id, so results computed over the
+// ids can be translated back through mapping.
+func (m *Map) DensifyKeys() (dense *Map, mapping *Map) {
+	items := m.sortedItems()
+	dense = m.newSized(len(items))
+	mapping = m.newSized(len(items))
+	for id, kv := range items {
+		dense.Put(uint64(id), kv[1])
+		mapping.Put(kv[0], uint64(id))
+	}
+	return dense, mapping
+}
+
+// SortedKeyValueSlices returns the keys in ascending order, the free key
+// included, and the values aligned with them, so vals[i] is the value of
+// keys[i]. Both slices have length Size().
+func (m *Map) SortedKeyValueSlices() (keys, vals []uint64) {
+	items := m.sortedItems()
+	keys = make([]uint64, len(items))
+	vals = make([]uint64, len(items))
+	for i, kv := range items {
+		keys[i], vals[i] = kv[0], kv[1]
+	}
+	return keys, vals
+}
+
+// ShuffledItems calls fn for every entry, the free key included, in a random
+// order drawn from rng, stopping early if fn returns false. It copies the
+// entries and shuffles them, so it takes O(n) extra space and is slower than
+// plain iteration; a given rng state always yields the same order for the
+// same map.
+func (m *Map) ShuffledItems(rng *rand.Rand, fn func(key, val uint64) bool) {
+	items := make([][2]uint64, 0, m.Size())
+	m.each(func(k, v uint64) bool {
+		items = append(items, [2]uint64{k, v})
+		return true
+	})
+	rng.Shuffle(len(items), func(i, j int) { items[i], items[j] = items[j], items[i] })
+	for _, kv := range items {
+		if !fn(kv[0], kv[1]) {
+			return
+		}
+	}
+}
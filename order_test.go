@@ -0,0 +1,124 @@
+package intintmap
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestNthKey(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	m := New(10, 0.6)
+	m.Put(0, 0)
+	for i := 0; i < 1000; i++ {
+		m.Put(uint64(rng.Intn(500)+1)*1000, 1)
+	}
+
+	sorted := m.SortedKeys()
+	if len(sorted) != m.Size() {
+		t.Errorf("got %d sorted keys, expected %d", len(sorted), m.Size())
+	}
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i-1] >= sorted[i] {
+			t.Errorf("keys are not sorted at index %d", i)
+		}
+	}
+	for n, want := range sorted {
+		if k, ok := m.NthKey(n); !ok || k != want {
+			t.Errorf("expected %d as key %d, got %d", want, n, k)
+		}
+	}
+	if _, ok := m.NthKey(-1); ok {
+		t.Errorf("didn't expect a key at index -1")
+	}
+	if _, ok := m.NthKey(m.Size()); ok {
+		t.Errorf("didn't expect a key at index %d", m.Size())
+	}
+}
+
+func TestDensifyKeys(t *testing.T) {
+	m := New(10, 0.6)
+	m.Put(1<<50, 1)
+	m.Put(0, 2)
+	m.Put(1<<30, 3)
+
+	dense, mapping := m.DensifyKeys()
+	for k, want := range map[uint64]uint64{0: 0, 1 << 30: 1, 1 << 50: 2} {
+		if id, ok := mapping.Get(k); !ok || id != want {
+			t.Errorf("expected id %d for key %d, got %d", want, k, id)
+		}
+	}
+	for kv := range m.Items() {
+		id, _ := mapping.Get(kv[0])
+		if v, ok := dense.Get(id); !ok || v != kv[1] {
+			t.Errorf("expected %d as value for id %d, got %d", kv[1], id, v)
+		}
+	}
+	if dense.Size() != 3 {
+		t.Errorf("size (%d) is not right, should be 3", dense.Size())
+	}
+}
+
+func TestSortedKeyValueSlices(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 1000; i++ {
+		m.Put(i*7919%1000, i)
+	}
+
+	keys, vals := m.SortedKeyValueSlices()
+	if len(keys) != m.Size() || len(vals) != m.Size() {
+		t.Errorf("got %d keys and %d values, expected %d", len(keys), len(vals), m.Size())
+	}
+	for j, k := range keys {
+		if k != uint64(j) {
+			t.Errorf("expected key %d at index %d, got %d", j, j, k)
+		}
+		if v, _ := m.Get(k); vals[j] != v {
+			t.Errorf("expected %d as value for key %d, got %d", v, k, vals[j])
+		}
+	}
+}
+
+func TestShuffledItems(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 100; i++ {
+		m.Put(i, i*2)
+	}
+
+	order := func(seed int64) []uint64 {
+		var keys []uint64
+		m.ShuffledItems(rand.New(rand.NewSource(seed)), func(k, v uint64) bool {
+			if v != k*2 {
+				t.Errorf("unexpected value %d for key %d", v, k)
+			}
+			keys = append(keys, k)
+			return true
+		})
+		return keys
+	}
+	a, b, c := order(1), order(1), order(2)
+	if len(a) != 100 {
+		t.Errorf("visited %d entries, expected 100", len(a))
+	}
+	same := true
+	for j := range a {
+		if a[j] != b[j] {
+			t.Errorf("expected the same order for the same seed")
+			break
+		}
+		same = same && a[j] == c[j]
+	}
+	if same {
+		t.Errorf("expected different orders for different seeds")
+	}
+
+	n := 0
+	m.ShuffledItems(rand.New(rand.NewSource(1)), func(uint64, uint64) bool {
+		n++
+		return n < 3
+	})
+	if n != 3 {
+		t.Errorf("expected iteration to stop after 3 entries, got %d", n)
+	}
+}
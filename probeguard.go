@@ -0,0 +1,10 @@
+//go:build intintmap_probeguard
+
+package intintmap
+
+// probeGuard makes every key lookup, from Get, Put and Del to the methods
+// built on lookup, panic instead of looping forever when a probe sequence
+// visits more slots than the table holds, which can only happen if the map
+// is corrupt. Build with -tags intintmap_probeguard to enable it; it costs a
+// counter per probe.
+const probeGuard = true
@@ -0,0 +1,6 @@
+//go:build !intintmap_probeguard
+
+package intintmap
+
+// probeGuard is disabled by default so the probe loops carry no extra work.
+const probeGuard = false
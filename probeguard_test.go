@@ -0,0 +1,37 @@
+//go:build intintmap_probeguard
+
+package intintmap
+
+import (
+	"testing"
+)
+
+func TestProbeGuard(t *testing.T) {
+	for _, hashed := range []bool{false, true} {
+		m := New(10, 0.6)
+		if hashed {
+			m = New(10, 0.6, WithHash(func(k uint64) uint64 { return pairHash(k, 1) }))
+		}
+		for i := 0; i < len(m.data); i += 2 { // corrupt: no free slot left
+			m.data[i] = uint64(i/2 + 1)
+		}
+
+		for name, op := range map[string]func(){
+			"Get":     func() { m.Get(1 << 40) },
+			"Put":     func() { m.Put(1<<40, 1) },
+			"Del":     func() { m.Del(1 << 40) },
+			"GetPtr":  func() { m.GetPtr(1 << 40) },
+			"PutIf":   func() { m.PutIf(1<<40, 1, func(uint64, bool) bool { return true }) },
+			"Replace": func() { m.Replace(1<<40, 1) },
+		} {
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Errorf("expected %s to panic on a table without free slots (hashed %v)", name, hashed)
+					}
+				}()
+				op()
+			}()
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package intintmap
+
+import (
+	"math/bits"
+)
+
+// KeysMatching returns the keys k, the free key included, for which
+// k&mask == want, in unspecified order. It is a convenience for keys that
+// encode fields in bit ranges, not an index: it scans the whole map in O(n).
+func (m *Map) KeysMatching(mask, want uint64) []uint64 {
+	var keys []uint64
+	m.each(func(k, _ uint64) bool {
+		if k&mask == want {
+			keys = append(keys, k)
+		}
+		return true
+	})
+	return keys
+}
+
+// KeysWithinHamming returns the entries, the free key included, whose key
+// differs from target in at most maxDist bits, in unspecified order. It is a
+// convenience for near-duplicate search over fingerprint keys, not an index:
+// it scans the whole map in O(n).
+func (m *Map) KeysWithinHamming(target uint64, maxDist int) [][2]uint64 {
+	var items [][2]uint64
+	m.each(func(k, v uint64) bool {
+		if bits.OnesCount64(k^target) <= maxDist {
+			items = append(items, [2]uint64{k, v})
+		}
+		return true
+	})
+	return items
+}
+
+// Query returns the entries, the free key included, that satisfy all of
+// preds, in unspecified order. Predicates are tried in order and an entry is
+// dropped at the first that rejects it; with no predicates every entry
+// matches. It scans the whole map in O(n * len(preds)) and returns a fresh
+// slice, saving the intermediate maps of chained filters.
+func (m *Map) Query(preds ...func(key, val uint64) bool) [][2]uint64 {
+	var items [][2]uint64
+	m.each(func(k, v uint64) bool {
+		for _, p := range preds {
+			if !p(k, v) {
+				return true
+			}
+		}
+		items = append(items, [2]uint64{k, v})
+		return true
+	})
+	return items
+}
+
+// QueryAny is like Query but returns the entries that satisfy any of preds,
+// stopping at the first that accepts an entry; with no predicates nothing
+// matches.
+func (m *Map) QueryAny(preds ...func(key, val uint64) bool) [][2]uint64 {
+	var items [][2]uint64
+	m.each(func(k, v uint64) bool {
+		for _, p := range preds {
+			if p(k, v) {
+				items = append(items, [2]uint64{k, v})
+				return true
+			}
+		}
+		return true
+	})
+	return items
+}
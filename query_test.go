@@ -0,0 +1,85 @@
+package intintmap
+
+import (
+	"testing"
+)
+
+func TestKeysMatching(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 100; i++ {
+		m.Put(i<<56|i, i) // type in the high byte
+	}
+
+	keys := m.KeysMatching(0xFF<<56, 7<<56)
+	if len(keys) != 1 || keys[0] != 7<<56|7 {
+		t.Errorf("expected only key %d, got %v", uint64(7<<56|7), keys)
+	}
+	if keys = m.KeysMatching(0xFF<<56, 0); len(keys) != 1 || keys[0] != 0 {
+		t.Errorf("expected only the free key, got %v", keys)
+	}
+	if keys = m.KeysMatching(1, 1); len(keys) != 50 {
+		t.Errorf("got %d odd keys, expected 50", len(keys))
+	}
+}
+
+func TestKeysWithinHamming(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 256; i++ {
+		m.Put(i, i+1)
+	}
+
+	items := m.KeysWithinHamming(0xFF, 1)
+	if len(items) != 9 {
+		t.Errorf("got %d entries, expected 9", len(items))
+	}
+	for _, kv := range items {
+		if kv[1] != kv[0]+1 {
+			t.Errorf("unexpected value %d for key %d", kv[1], kv[0])
+		}
+	}
+	found := false
+	for _, kv := range m.KeysWithinHamming(1, 1) {
+		found = found || kv[0] == 0
+	}
+	if !found {
+		t.Errorf("expected the free key within distance 1 of 1")
+	}
+}
+
+func TestQuery(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 100; i++ {
+		m.Put(i, i*2)
+	}
+	even := func(k, _ uint64) bool { return k%2 == 0 }
+	small := func(_, v uint64) bool { return v < 20 }
+
+	items := m.Query(even, small)
+	if len(items) != 5 {
+		t.Errorf("got %d entries, expected 5", len(items))
+	}
+	for _, kv := range items {
+		if kv[0]%2 != 0 || kv[1] >= 20 || kv[1] != kv[0]*2 {
+			t.Errorf("unexpected entry %v", kv)
+		}
+	}
+	if items = m.Query(); len(items) != 100 {
+		t.Errorf("got %d entries without predicates, expected 100", len(items))
+	}
+
+	items = m.QueryAny(even, small)
+	if len(items) != 55 {
+		t.Errorf("got %d entries, expected 55", len(items))
+	}
+	for _, kv := range items {
+		if kv[0]%2 != 0 && kv[1] >= 20 {
+			t.Errorf("unexpected entry %v", kv)
+		}
+	}
+	if items = m.QueryAny(); len(items) != 0 {
+		t.Errorf("got %d entries without predicates, expected 0", len(items))
+	}
+}
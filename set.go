@@ -0,0 +1,266 @@
+package intintmap
+
+import (
+	"math"
+)
+
+// Set is a set of uint64s using the same open addressing scheme as Map but
+// storing keys only, so it takes half the memory of a Map with dummy values.
+type Set struct {
+	keys       []uint64
+	fillFactor float64
+	threshold  int // we will resize a set once it reaches this size
+	size       int
+
+	mask uint64 // mask to calculate the original position
+
+	hasFreeKey bool // do we have 'free' key in the set?
+}
+
+// NewSet returns a set initialized with n spaces and uses the stated
+// fillFactor. The set will grow as needed.
+func NewSet(size int, fillFactor float64) *Set {
+	if fillFactor <= 0 || fillFactor >= 1 {
+		panic("FillFactor must be in (0, 1)")
+	}
+	if size <= 0 {
+		panic("Size must be positive")
+	}
+
+	capacity := arraySize(size, fillFactor)
+	return &Set{
+		keys:       make([]uint64, capacity),
+		fillFactor: fillFactor,
+		threshold:  int(math.Floor(float64(capacity) * fillFactor)),
+		mask:       uint64(capacity - 1),
+	}
+}
+
+// Has reports whether key is in the set.
+func (s *Set) Has(key uint64) bool {
+	if key == FREE_KEY {
+		return s.hasFreeKey
+	}
+
+	ptr := phiMix(key) & s.mask
+	var k uint64
+	for {
+		k = s.keys[ptr]
+		if k == key {
+			return true
+		}
+		if k == FREE_KEY {
+			return false
+		}
+		ptr = (ptr + 1) & s.mask
+	}
+}
+
+// Add adds key to the set.
+func (s *Set) Add(key uint64) {
+	if key == FREE_KEY {
+		if !s.hasFreeKey {
+			s.size++
+		}
+		s.hasFreeKey = true
+		return
+	}
+
+	ptr := phiMix(key) & s.mask
+	var k uint64
+	for {
+		k = s.keys[ptr]
+		if k == key {
+			return
+		}
+		if k == FREE_KEY {
+			s.keys[ptr] = key
+			if s.size >= s.threshold {
+				s.rehash()
+			} else {
+				s.size++
+			}
+			return
+		}
+		ptr = (ptr + 1) & s.mask
+	}
+}
+
+// Remove removes key from the set.
+func (s *Set) Remove(key uint64) {
+	if key == FREE_KEY {
+		if s.hasFreeKey {
+			s.hasFreeKey = false
+			s.size--
+		}
+		return
+	}
+
+	ptr := phiMix(key) & s.mask
+	var k uint64
+	for {
+		k = s.keys[ptr]
+		if k == key {
+			s.shiftKeys(ptr)
+			s.size--
+			return
+		}
+		if k == FREE_KEY {
+			return
+		}
+		ptr = (ptr + 1) & s.mask
+	}
+}
+
+func (s *Set) shiftKeys(pos uint64) {
+	// Shift entries with the same hash.
+	var last, slot uint64
+	var k uint64
+	var keys = s.keys
+	for {
+		last = pos
+		pos = (last + 1) & s.mask
+		for {
+			k = keys[pos]
+			if k == FREE_KEY {
+				keys[last] = FREE_KEY
+				return
+			}
+
+			slot = phiMix(k) & s.mask
+			if last <= pos {
+				if last >= slot || slot > pos {
+					break
+				}
+			} else {
+				if last >= slot && slot > pos {
+					break
+				}
+			}
+			pos = (pos + 1) & s.mask
+		}
+		keys[last] = k
+	}
+}
+
+func (s *Set) rehash() {
+	newCapacity := len(s.keys) * 2
+	s.threshold = int(math.Floor(float64(newCapacity) * s.fillFactor))
+	s.mask = uint64(newCapacity - 1)
+
+	keys := s.keys // original keys
+	s.keys = make([]uint64, newCapacity)
+	if s.hasFreeKey { // reset size
+		s.size = 1
+	} else {
+		s.size = 0
+	}
+
+	for _, k := range keys {
+		if k != FREE_KEY {
+			s.Add(k)
+		}
+	}
+}
+
+// Len returns the number of keys in the set.
+func (s *Set) Len() int {
+	return s.size
+}
+
+// each calls fn for every key in the set, the free key first, stopping early
+// if fn returns false.
+func (s *Set) each(fn func(key uint64) bool) {
+	if s.hasFreeKey {
+		if !fn(FREE_KEY) {
+			return
+		}
+	}
+	for _, k := range s.keys {
+		if k != FREE_KEY {
+			if !fn(k) {
+				return
+			}
+		}
+	}
+}
+
+// Keys returns a channel for iterating all keys.
+func (s *Set) Keys() chan uint64 {
+	c := make(chan uint64, 10)
+	go func() {
+		s.each(func(k uint64) bool {
+			c <- k
+			return true
+		})
+		close(c)
+	}()
+	return c
+}
+
+// newSized returns an empty set able to hold size keys without growing,
+// using the fill factor of s.
+func (s *Set) newSized(size int) *Set {
+	if size < 1 {
+		size = 1
+	}
+	return NewSet(size, s.fillFactor)
+}
+
+// Union returns a new set holding the keys in s or other.
+func (s *Set) Union(other *Set) *Set {
+	u := s.newSized(s.Len() + other.Len())
+	s.each(func(k uint64) bool {
+		u.Add(k)
+		return true
+	})
+	other.each(func(k uint64) bool {
+		u.Add(k)
+		return true
+	})
+	return u
+}
+
+// Intersection returns a new set holding the keys in both s and other.
+func (s *Set) Intersection(other *Set) *Set {
+	small, large := s, other
+	if large.Len() < small.Len() {
+		small, large = large, small
+	}
+	r := s.newSized(small.Len())
+	small.each(func(k uint64) bool {
+		if large.Has(k) {
+			r.Add(k)
+		}
+		return true
+	})
+	return r
+}
+
+// Difference returns a new set holding the keys in s but not in other.
+func (s *Set) Difference(other *Set) *Set {
+	r := s.newSized(s.Len())
+	s.each(func(k uint64) bool {
+		if !other.Has(k) {
+			r.Add(k)
+		}
+		return true
+	})
+	return r
+}
+
+// KeySet returns a new Set of the keys of m, the free key included. It
+// shares no storage with m, so later changes to either don't affect the
+// other, and costs O(Size()) to build.
+func (m *Map) KeySet() *Set {
+	size := m.Size()
+	if size < 1 {
+		size = 1
+	}
+	s := NewSet(size, m.fillFactor)
+	m.each(func(k, _ uint64) bool {
+		s.Add(k)
+		return true
+	})
+	return s
+}
@@ -0,0 +1,98 @@
+package intintmap
+
+import (
+	"testing"
+)
+
+func TestSet(t *testing.T) {
+	s := NewSet(10, 0.6)
+	var i uint64
+	for i = 0; i < 20000; i += 2 {
+		s.Add(i)
+	}
+	s.Add(0)
+	if s.Len() != 10000 {
+		t.Errorf("size (%d) is not right, should be 10000", s.Len())
+	}
+	for i = 0; i < 20000; i += 2 {
+		if !s.Has(i) {
+			t.Errorf("expected key %d in set", i)
+		}
+		if s.Has(i + 1) {
+			t.Errorf("didn't expect key %d in set", i+1)
+		}
+	}
+
+	for i = 0; i < 20000; i += 4 {
+		s.Remove(i)
+	}
+	s.Remove(1)
+	if s.Len() != 5000 {
+		t.Errorf("size (%d) is not right, should be 5000", s.Len())
+	}
+	for i = 0; i < 20000; i += 2 {
+		if s.Has(i) != (i%4 != 0) {
+			t.Errorf("unexpected membership for key %d", i)
+		}
+	}
+
+	n := 0
+	for range s.Keys() {
+		n++
+	}
+	if n != s.Len() {
+		t.Errorf("iterated %d keys, expected %d", n, s.Len())
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	a, b := NewSet(10, 0.6), NewSet(10, 0.6)
+	var i uint64
+	for i = 0; i < 100; i++ {
+		if i%2 == 0 {
+			a.Add(i)
+		}
+		if i%3 == 0 {
+			b.Add(i)
+		}
+	}
+
+	u, in, d := a.Union(b), a.Intersection(b), a.Difference(b)
+	for i = 0; i < 100; i++ {
+		if u.Has(i) != (i%2 == 0 || i%3 == 0) {
+			t.Errorf("unexpected union membership for key %d", i)
+		}
+		if in.Has(i) != (i%6 == 0) {
+			t.Errorf("unexpected intersection membership for key %d", i)
+		}
+		if d.Has(i) != (i%2 == 0 && i%3 != 0) {
+			t.Errorf("unexpected difference membership for key %d", i)
+		}
+	}
+	if a.Len() != 50 || b.Len() != 34 {
+		t.Errorf("set algebra modified its operands")
+	}
+}
+
+func TestKeySet(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 1000; i++ {
+		m.Put(i, i)
+	}
+
+	s := m.KeySet()
+	if s.Len() != m.Size() {
+		t.Errorf("size (%d) is not right, should be %d", s.Len(), m.Size())
+	}
+	for i = 0; i < 1000; i++ {
+		if !s.Has(i) {
+			t.Errorf("expected key %d in set", i)
+		}
+	}
+	m.Del(5)
+	m.Put(5000, 1)
+	if !s.Has(5) || s.Has(5000) {
+		t.Errorf("didn't expect changes to the map to reach the set")
+	}
+}
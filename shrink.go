@@ -0,0 +1,78 @@
+package intintmap
+
+import (
+	"time"
+)
+
+// WithAutoShrink makes deletions shrink the table once it is less than
+// minLoad full, rebuilding it with the number of slots New would pick for
+// the remaining entries, so a map that was briefly large gives its memory
+// back. minLoad must be in (0, 1); values well below the fill factor, e.g. a
+// quarter of it, avoid growing and shrinking around the same size. Shrinking
+// is checked by Del and by operations that delete in bulk, such as Extract,
+// and can be throttled with WithRehashCooldown.
+func WithAutoShrink(minLoad float64) Option {
+	if minLoad <= 0 || minLoad >= 1 {
+		panic("MinLoad must be in (0, 1)")
+	}
+	return func(m *Map) {
+		m.shrinkLoad = minLoad
+	}
+}
+
+// WithRehashCooldown keeps the map from rehashing for an optional shrink
+// within d of its previous rehash, protecting latency-sensitive callers from
+// rehash storms under oscillating load. A shrink that comes due during the
+// cooldown is put off until the first Put or Del after it, which shrinks the
+// table if it is still underfull; Get never resizes. Every resize restarts
+// the cooldown and drops a pending shrink: growth past the fill factor, which
+// is needed for correctness and always happens immediately, as well as
+// Reserve, ReserveForLoad, EvictToFit, SetHash, SetAll and Reindex. Without
+// WithAutoShrink there is nothing to throttle.
+func WithRehashCooldown(d time.Duration) Option {
+	return func(m *Map) {
+		m.cooldown = d
+		if m.now == nil {
+			m.now = time.Now
+		}
+	}
+}
+
+// withClock makes the map read the time from now instead of time.Now.
+func withClock(now func() time.Time) Option {
+	return func(m *Map) {
+		m.now = now
+	}
+}
+
+// stampRehash records the time of a rehash for WithRehashCooldown and drops
+// any shrink put off until after it.
+func (m *Map) stampRehash() {
+	m.shrinkDue = false
+	if m.cooldown > 0 {
+		m.lastRehash = m.now()
+	}
+}
+
+// maybeShrink shrinks the table after a deletion if WithAutoShrink asks for
+// it and WithRehashCooldown allows it, or marks the shrink as due otherwise.
+func (m *Map) maybeShrink() {
+	m.shrinkDue = false
+	entries := m.size
+	if m.hasFreeKey {
+		entries--
+	}
+	slots := len(m.data) / 2
+	if float64(entries) >= m.shrinkLoad*float64(slots) {
+		return
+	}
+	want := arraySize(entries+1, m.fillFactor)
+	if want >= slots {
+		return
+	}
+	if m.cooldown > 0 && m.now().Sub(m.lastRehash) < m.cooldown {
+		m.shrinkDue = true
+		return
+	}
+	m.resize(want)
+}
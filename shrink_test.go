@@ -0,0 +1,149 @@
+package intintmap
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAutoShrink(t *testing.T) {
+	m := New(10, 0.6, WithAutoShrink(0.15))
+	var i uint64
+	for i = 1; i <= 10000; i++ {
+		m.Put(i, i)
+	}
+	grown := len(m.data) / 2
+	for i = 1; i <= 9900; i++ {
+		m.Del(i)
+	}
+	if slots := len(m.data) / 2; slots >= grown/16 {
+		t.Errorf("table still has %d slots for %d entries", slots, m.Size())
+	}
+	for i = 9901; i <= 10000; i++ {
+		if v, ok := m.Get(i); !ok || v != i {
+			t.Errorf("expected %d as value for key %d, got %d", i, i, v)
+		}
+	}
+
+	m.Extract(func(k, _ uint64) bool { return k > 9910 })
+	if slots := len(m.data) / 2; slots > arraySize(m.Size()+1, 0.6) {
+		t.Errorf("table still has %d slots for %d entries after Extract", slots, m.Size())
+	}
+}
+
+func TestRehashCooldown(t *testing.T) {
+	now := time.Unix(0, 0)
+	clock := func() time.Time { return now }
+	m := New(10, 0.6, WithAutoShrink(0.15), WithRehashCooldown(time.Minute), withClock(clock))
+
+	var i uint64
+	for i = 1; i <= 10000; i++ {
+		m.Put(i, i) // growth is never held back
+	}
+	if m.Size() != 10000 || len(m.data)/2 < arraySize(10000, 0.6) {
+		t.Errorf("expected the map to grow immediately")
+	}
+
+	grown := len(m.data) / 2
+	for i = 1; i <= 9900; i++ {
+		m.Del(i)
+	}
+	if slots := len(m.data) / 2; slots != grown {
+		t.Errorf("table shrank to %d slots during the cooldown", slots)
+	}
+
+	now = now.Add(59 * time.Second)
+	m.Del(9901)
+	if slots := len(m.data) / 2; slots != grown {
+		t.Errorf("table shrank to %d slots during the cooldown", slots)
+	}
+
+	now = now.Add(time.Second)
+	m.Del(9902)
+	if slots := len(m.data) / 2; slots >= grown {
+		t.Errorf("expected the table to shrink after the cooldown")
+	}
+	shrunk := len(m.data) / 2
+
+	// Growing back restarts the cooldown.
+	for i = 1; i <= 10000; i++ {
+		m.Put(i, i)
+	}
+	for i = 1; i <= 9900; i++ {
+		m.Del(i)
+	}
+	if slots := len(m.data) / 2; slots <= shrunk {
+		t.Errorf("table shrank to %d slots right after growing", slots)
+	}
+	now = now.Add(time.Minute)
+	m.Del(9901)
+	if slots := len(m.data) / 2; slots != shrunk {
+		t.Errorf("table has %d slots after the cooldown, expected %d", slots, shrunk)
+	}
+	for i = 9902; i <= 10000; i++ {
+		if v, ok := m.Get(i); !ok || v != i {
+			t.Errorf("expected %d as value for key %d, got %d", i, i, v)
+		}
+	}
+}
+
+func TestRehashCooldownDeferredShrink(t *testing.T) {
+	now := time.Unix(0, 0)
+	clock := func() time.Time { return now }
+	m := New(10, 0.6, WithAutoShrink(0.15), WithRehashCooldown(time.Minute), withClock(clock))
+
+	var i uint64
+	for i = 1; i <= 10000; i++ {
+		m.Put(i, i)
+	}
+	grown := len(m.data) / 2
+	for i = 1; i <= 9900; i++ {
+		m.Del(i)
+	}
+
+	// A put-only workload picks up the shrink put off by the cooldown.
+	now = now.Add(time.Minute)
+	m.Get(9950)
+	if slots := len(m.data) / 2; slots != grown {
+		t.Errorf("Get resized the table to %d slots", slots)
+	}
+	m.Put(9950, 1)
+	if slots := len(m.data) / 2; slots >= grown {
+		t.Errorf("expected the first Put after the cooldown to shrink the table")
+	}
+
+	// Deleting the free key checks for a shrink as well.
+	m.Put(0, 1)
+	for i = 1; i <= 10000; i++ {
+		m.Put(i, i)
+	}
+	for i = 1; i <= 9950; i++ {
+		m.Del(i)
+	}
+	grown = len(m.data) / 2
+	now = now.Add(time.Minute)
+	m.Del(0)
+	if slots := len(m.data) / 2; slots >= grown {
+		t.Errorf("expected deleting the free key after the cooldown to shrink the table")
+	}
+
+	// An explicit resize restarts the cooldown and drops the pending shrink.
+	now = now.Add(time.Minute)
+	m.Reserve(10000)
+	reserved := len(m.data) / 2
+	now = now.Add(59 * time.Second)
+	m.Del(9999)
+	m.Put(9999, 1)
+	if slots := len(m.data) / 2; slots != reserved {
+		t.Errorf("table resized to %d slots within the cooldown after Reserve", slots)
+	}
+	now = now.Add(time.Second)
+	m.Put(9999, 2)
+	if slots := len(m.data) / 2; slots >= reserved {
+		t.Errorf("expected the table to shrink once the cooldown after Reserve passed")
+	}
+	for i = 9951; i <= 10000; i++ {
+		if _, ok := m.Get(i); !ok {
+			t.Errorf("expected key %d to be present", i)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package intintmap
+
+import (
+	"sync/atomic"
+)
+
+// SingleWriterMap is a map for one writer goroutine and any number of
+// concurrent readers. The writer mutates a private map; Commit publishes a
+// copy of it as an immutable snapshot through an atomic pointer swap, so
+// reads never lock and the copy cost is paid once per Commit rather than
+// once per write.
+//
+// Readers see the last committed snapshot: writes made since the previous
+// Commit are invisible to Get until the next Commit.
+type SingleWriterMap struct {
+	w    *Map
+	snap atomic.Pointer[Map]
+}
+
+// NewSingleWriter returns an empty SingleWriterMap whose writer map is
+// created with New(size, fillFactor).
+func NewSingleWriter(size int, fillFactor float64) *SingleWriterMap {
+	s := &SingleWriterMap{w: New(size, fillFactor)}
+	s.snap.Store(s.w.Clone())
+	return s
+}
+
+// Get returns the value of key in the last committed snapshot. It is safe
+// to call from any goroutine.
+func (s *SingleWriterMap) Get(key uint64) (uint64, bool) {
+	return s.snap.Load().Get(key)
+}
+
+// Snapshot returns the last committed snapshot. It must not be modified.
+func (s *SingleWriterMap) Snapshot() *Map {
+	return s.snap.Load()
+}
+
+// Put adds or updates key in the writer map. Only the writer may call it.
+func (s *SingleWriterMap) Put(key uint64, val uint64) {
+	s.w.Put(key, val)
+}
+
+// Del deletes key from the writer map. Only the writer may call it.
+func (s *SingleWriterMap) Del(key uint64) {
+	s.w.Del(key)
+}
+
+// Commit publishes the writer map's current contents to readers. Only the
+// writer may call it.
+func (s *SingleWriterMap) Commit() {
+	s.snap.Store(s.w.Clone())
+}
@@ -0,0 +1,66 @@
+package intintmap
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSingleWriterMap(t *testing.T) {
+	s := NewSingleWriter(10, 0.6)
+	s.Put(1, 10)
+	s.Put(0, 5)
+	if _, ok := s.Get(1); ok {
+		t.Errorf("didn't expect uncommitted key to be visible")
+	}
+
+	s.Commit()
+	if v, ok := s.Get(1); !ok || v != 10 {
+		t.Errorf("expected 10 as value for key 1, got %d", v)
+	}
+	if v, ok := s.Get(0); !ok || v != 5 {
+		t.Errorf("expected 5 as value for key 0, got %d", v)
+	}
+
+	s.Del(1)
+	if _, ok := s.Get(1); !ok {
+		t.Errorf("expected committed key to stay visible until the next commit")
+	}
+	s.Commit()
+	if _, ok := s.Get(1); ok {
+		t.Errorf("didn't expect deleted key after commit")
+	}
+}
+
+func BenchmarkSingleWriterMapGet(b *testing.B) {
+	s := NewSingleWriter(2048, 0.6)
+	var j uint64
+	for j = 0; j < 2048; j++ {
+		s.Put(j, j)
+	}
+	s.Commit()
+	b.RunParallel(func(pb *testing.PB) {
+		var k uint64
+		for pb.Next() {
+			s.Get(k & 2047)
+			k++
+		}
+	})
+}
+
+func BenchmarkRWMutexMapGet(b *testing.B) {
+	var mu sync.RWMutex
+	m := New(2048, 0.6)
+	var j uint64
+	for j = 0; j < 2048; j++ {
+		m.Put(j, j)
+	}
+	b.RunParallel(func(pb *testing.PB) {
+		var k uint64
+		for pb.Next() {
+			mu.RLock()
+			m.Get(k & 2047)
+			mu.RUnlock()
+			k++
+		}
+	})
+}
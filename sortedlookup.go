@@ -0,0 +1,49 @@
+package intintmap
+
+import (
+	"sort"
+)
+
+// SortedLookup is an immutable map stored as sorted keys with parallel
+// values. Lookups are binary searches, slower than a Map's but in a
+// structure with no free slots, and it supports ordered range scans.
+type SortedLookup struct {
+	keys []uint64
+	vals []uint64
+}
+
+// ToSortedLookup returns a SortedLookup holding the entries of m. It shares
+// no storage with m, so m can be dropped and its table garbage collected
+// once the lookup is built.
+func (m *Map) ToSortedLookup() *SortedLookup {
+	keys, vals := m.SortedKeyValueSlices()
+	return &SortedLookup{keys: keys, vals: vals}
+}
+
+// Len returns the number of entries.
+func (l *SortedLookup) Len() int {
+	return len(l.keys)
+}
+
+// search returns the index of the first key not less than key.
+func (l *SortedLookup) search(key uint64) int {
+	return sort.Search(len(l.keys), func(i int) bool { return l.keys[i] >= key })
+}
+
+// Get returns the value if the key is found.
+func (l *SortedLookup) Get(key uint64) (uint64, bool) {
+	if i := l.search(key); i < len(l.keys) && l.keys[i] == key {
+		return l.vals[i], true
+	}
+	return 0, false
+}
+
+// Range returns the entries with lo <= key < hi in ascending key order, as
+// parallel slices that alias the lookup's storage and must not be modified.
+func (l *SortedLookup) Range(lo, hi uint64) (keys, vals []uint64) {
+	if hi <= lo {
+		return nil, nil
+	}
+	i, j := l.search(lo), l.search(hi)
+	return l.keys[i:j], l.vals[i:j]
+}
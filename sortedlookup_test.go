@@ -0,0 +1,61 @@
+package intintmap
+
+import (
+	"testing"
+)
+
+func TestSortedLookup(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 1000; i++ {
+		m.Put(i*3, i)
+	}
+	l := m.ToSortedLookup()
+	if l.Len() != 1000 {
+		t.Errorf("size (%d) is not right, should be 1000", l.Len())
+	}
+	for i = 0; i < 3000; i++ {
+		v, ok := l.Get(i)
+		if i%3 == 0 && (!ok || v != i/3) {
+			t.Errorf("expected %d as value for key %d, got %d", i/3, i, v)
+		}
+		if i%3 != 0 && ok {
+			t.Errorf("didn't expect key %d", i)
+		}
+	}
+
+	keys, vals := l.Range(10, 31)
+	if len(keys) != 7 || keys[0] != 12 || keys[6] != 30 {
+		t.Errorf("unexpected range keys %v", keys)
+	}
+	for j, k := range keys {
+		if vals[j] != k/3 {
+			t.Errorf("expected %d as value for key %d, got %d", k/3, k, vals[j])
+		}
+	}
+	if keys, _ = l.Range(31, 10); len(keys) != 0 {
+		t.Errorf("expected an empty range, got %v", keys)
+	}
+
+	m.Put(1, 1)
+	if _, ok := l.Get(1); ok {
+		t.Errorf("didn't expect changes to the map to reach the lookup")
+	}
+}
+
+func BenchmarkSortedLookupGet(b *testing.B) {
+	m := New(2048, 0.60)
+	fillIntIntMap(m)
+	l := m.ToSortedLookup()
+	b.ResetTimer()
+	var j, v, sum uint64
+	var ok bool
+	for i := 0; i < b.N; i++ {
+		sum = 0
+		for j = 0; j < MAX; j += STEP {
+			if v, ok = l.Get(j); ok {
+				sum += v
+			}
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package intintmap
+
+import (
+	"math"
+	"sort"
+	"unsafe"
+)
+
+// ItemsWithProbeDistance calls fn for every entry together with its probe
+// distance, the number of slots it sits past its home slot, stopping early
+// if fn returns false. The free key has no slot and reports distance 0. The
+// iteration order is unspecified.
+func (m *Map) ItemsWithProbeDistance(fn func(key, val uint64, dist int) bool) {
+	if m.hasFreeKey {
+		if !fn(FREE_KEY, m.freeVal, 0) {
+			return
+		}
+	}
+
+	data := m.data
+	var k, home uint64
+	for i := 0; i < len(data); i += 2 {
+		k = data[i]
+		if k == FREE_KEY {
+			continue
+		}
+		home = (m.mix(k) & m.mask) << 1
+		if !fn(k, data[i+1], int(((uint64(i)-home)&m.mask2)>>1)) {
+			return
+		}
+	}
+}
+
+// DefaultDegradedFactor is the factor by which the average probe length must
+// exceed its expected value for IsDegraded to report true, unless changed
+// with WithDegradedFactor.
+const DefaultDegradedFactor = 4
+
+// degradedSamples is the most slots IsDegraded examines.
+const degradedSamples = 4096
+
+// WithDegradedFactor sets the factor IsDegraded compares against.
+func WithDegradedFactor(factor float64) Option {
+	if factor <= 1 {
+		panic("Factor must be greater than 1")
+	}
+	return func(m *Map) {
+		m.degradedFactor = factor
+	}
+}
+
+// IsDegraded reports whether lookups have become much slower than the load
+// factor predicts, as happens when the map is hash-flooded or the keys are
+// pathologically distributed. It compares the average number of slots a
+// successful lookup probes, (1 + 1/(1-load))/2 for linear probing, against
+// DefaultDegradedFactor (or the WithDegradedFactor setting) times that.
+//
+// Tables of more than 4096 slots are sampled rather than scanned: the slots
+// at 4096 evenly spaced positions are examined, which hits each cluster of
+// occupied slots in proportion to its length.
+func (m *Map) IsDegraded() bool {
+	entries := m.size
+	if m.hasFreeKey {
+		entries--
+	}
+	slots := len(m.data) / 2
+	if entries == 0 {
+		return false
+	}
+
+	factor := m.degradedFactor
+	if factor == 0 {
+		factor = DefaultDegradedFactor
+	}
+	load := float64(entries) / float64(slots)
+	expected := (1 + 1/(1-load)) / 2
+
+	step := 1
+	if slots > degradedSamples {
+		step = slots / degradedSamples
+	}
+	var n, probes int
+	var k, home uint64
+	for i := 0; i < len(m.data); i += 2 * step {
+		k = m.data[i]
+		if k == FREE_KEY {
+			continue
+		}
+		home = (m.mix(k) & m.mask) << 1
+		probes += int(((uint64(i)-home)&m.mask2)>>1) + 1
+		n++
+	}
+	return n > 0 && float64(probes)/float64(n) > factor*expected
+}
+
+// SharesStorage reports whether the backing arrays of a and b overlap, as
+// for a map and a shallow copy of it, or maps built by NewFromPool over
+// overlapping parts of one buffer. A released map shares nothing. It is
+// meant for tests and debugging, e.g. asserting that a copy is independent
+// of its original.
+func SharesStorage(a, b *Map) bool {
+	if len(a.data) == 0 || len(b.data) == 0 {
+		return false
+	}
+	aStart := uintptr(unsafe.Pointer(&a.data[0]))
+	bStart := uintptr(unsafe.Pointer(&b.data[0]))
+	aEnd := aStart + uintptr(len(a.data))*unsafe.Sizeof(a.data[0])
+	bEnd := bStart + uintptr(len(b.data))*unsafe.Sizeof(b.data[0])
+	return aStart < bEnd && bStart < aEnd
+}
+
+// BucketLoads returns how many entries fall into each of buckets groups when
+// keys are grouped by the same hash Split uses, so BucketLoads(n)[i] is the
+// size of Split(n)[i]. It shows whether keys would spread evenly over a
+// number of shards without building them. The free key is counted in its
+// hashed bucket like any other key. It takes a single O(n) pass.
+func (m *Map) BucketLoads(buckets int) []int {
+	if buckets <= 0 {
+		panic("Buckets must be positive")
+	}
+	loads := make([]int, buckets)
+	m.each(func(k, _ uint64) bool {
+		loads[pairHash(k, 0)%uint64(buckets)]++
+		return true
+	})
+	return loads
+}
+
+// Occupancy returns the number of slots in the table and, for each slot in
+// the order of the backing array, whether it holds an entry. The free key
+// has no slot and is not represented. The result is a snapshot, invalidated
+// by the next mutation.
+func (m *Map) Occupancy() (slots int, occupied []bool) {
+	slots = len(m.data) / 2
+	occupied = make([]bool, slots)
+	for i := range occupied {
+		occupied[i] = m.data[2*i] != FREE_KEY
+	}
+	return slots, occupied
+}
+
+// NoHome is the home slot LongestChain reports when there is no entry in the
+// table; it is also the home of the free key, which is stored outside it.
+const NoHome = ^uint64(0)
+
+// LongestChain returns the slot that is home to the most keys and those
+// keys, naming the keys that cluster together and slow lookups down. Keys
+// with the same home always share a cluster of occupied slots, so it counts
+// homes one cluster at a time, keeping memory proportional to the longest
+// cluster, then collects the winning keys in a second pass. The free key has
+// no home and is never reported; for a table without entries, home is
+// NoHome and keys is nil. Ties go to the first home found.
+func (m *Map) LongestChain() (home uint64, keys []uint64) {
+	var start uint64
+	for m.data[start] != FREE_KEY { // there is always at least one free slot
+		start += 2
+	}
+
+	home = NoHome
+	best := 0
+	var homes []uint64
+	ptr := start
+	for n := len(m.data) / 2; n > 0; n-- {
+		ptr = (ptr + 2) & m.mask2
+		if k := m.data[ptr]; k != FREE_KEY {
+			homes = append(homes, m.mix(k)&m.mask)
+			continue
+		}
+		// End of a cluster: find its most common home.
+		sort.Slice(homes, func(i, j int) bool { return homes[i] < homes[j] })
+		for i := 0; i < len(homes); {
+			j := i
+			for j < len(homes) && homes[j] == homes[i] {
+				j++
+			}
+			if j-i > best {
+				home, best = homes[i], j-i
+			}
+			i = j
+		}
+		homes = homes[:0]
+	}
+
+	if home == NoHome {
+		return NoHome, nil
+	}
+	keys = make([]uint64, 0, best)
+	for i := 0; i < len(m.data); i += 2 {
+		if k := m.data[i]; k != FREE_KEY && m.mix(k)&m.mask == home {
+			keys = append(keys, k)
+		}
+	}
+	return home, keys
+}
+
+// Clustering returns how much longer the probe chains are than uniformly
+// hashed keys would give at the same load, from 0 (no worse) towards 1. With
+// avg the average number of slots a successful lookup probes and
+// want = (1 + 1/(1-load))/2 its expected value under linear probing, it is
+// max(0, 1 - want/avg). Well spread keys report about 0; a high value means
+// keys collide in the hash and pile up in clusters.
+//
+// It doesn't measure damage from deletions: deleting shifts the rest of the
+// chain back, leaving the same probe lengths as if the key had never been
+// inserted, so rebuilding the table at the same size, e.g. with Reindex,
+// doesn't lower it. A larger table (Reserve) or a better hash (SetHash) does.
+// It scans the whole table.
+func (m *Map) Clustering() float64 {
+	entries := m.size
+	if m.hasFreeKey {
+		entries--
+	}
+	if entries == 0 {
+		return 0
+	}
+
+	var probes int
+	m.ItemsWithProbeDistance(func(k, _ uint64, dist int) bool {
+		if k != FREE_KEY {
+			probes += dist + 1
+		}
+		return true
+	})
+	load := float64(entries) / float64(len(m.data)/2)
+	want := (1 + 1/(1-load)) / 2
+	avg := float64(probes) / float64(entries)
+	return math.Max(0, 1-want/avg)
+}
+
+// IsAtHome reports whether key is present and, if so, whether it sits in
+// its home slot, so finding it takes no probing beyond the first slot. The
+// free key is stored outside the table and is always at home. It is meant
+// for tests and debugging, e.g. checking how a rehash placed specific keys.
+func (m *Map) IsAtHome(key uint64) (home bool, found bool) {
+	if key == FREE_KEY {
+		return m.hasFreeKey, m.hasFreeKey
+	}
+	ptr, ok := m.lookup(key)
+	if !ok {
+		return false, false
+	}
+	return ptr == (m.mix(key)&m.mask)<<1, true
+}
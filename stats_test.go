@@ -0,0 +1,236 @@
+package intintmap
+
+import (
+	"math"
+	"testing"
+)
+
+func TestItemsWithProbeDistance(t *testing.T) {
+	m := New(10, 0.9)
+	var i uint64
+	for i = 0; i < 1000; i++ {
+		m.Put(i, i)
+	}
+
+	n := 0
+	m.ItemsWithProbeDistance(func(k, v uint64, dist int) bool {
+		n++
+		if k == FREE_KEY {
+			if dist != 0 {
+				t.Errorf("expected distance 0 for the free key, got %d", dist)
+			}
+			return true
+		}
+		// Walk the probe sequence from the home slot to check the distance.
+		ptr := (phiMix(k) & m.mask) << 1
+		for d := 0; d < dist; d++ {
+			ptr = (ptr + 2) & m.mask2
+		}
+		if m.data[ptr] != k {
+			t.Errorf("key %d is not %d slots past its home", k, dist)
+		}
+		return true
+	})
+	if n != m.Size() {
+		t.Errorf("iterated %d entries, expected %d", n, m.Size())
+	}
+}
+
+func TestIsDegraded(t *testing.T) {
+	m := New(1<<14, 0.9)
+	var i uint64
+	for i = 1; i < 1<<14; i++ {
+		m.Put(i*0x9E3779B97F4A7C15, i)
+	}
+	if m.IsDegraded() {
+		t.Errorf("didn't expect a map of well mixed keys to be degraded")
+	}
+
+	// Keys whose phiMix agrees in the low bits all share a home slot.
+	f := New(1<<14, 0.9, WithDegradedFactor(2))
+	for i = 1; f.Size() < 2000; i++ {
+		if phiMix(i)&f.mask == phiMix(1)&f.mask {
+			f.Put(i, i)
+		}
+	}
+	if !f.IsDegraded() {
+		t.Errorf("expected a map of colliding keys to be degraded")
+	}
+}
+
+func TestSharesStorage(t *testing.T) {
+	m := New(10, 0.6)
+	m.Put(1, 1)
+	alias := *m
+	if !SharesStorage(m, &alias) {
+		t.Errorf("expected a shallow copy to share storage")
+	}
+	if SharesStorage(m, m.Clone()) {
+		t.Errorf("didn't expect Clone to share storage")
+	}
+
+	buf := make([]uint64, 16)
+	whole := NewFromPool(buf, 0.6)
+	low, high := NewFromPool(buf[:8], 0.6), NewFromPool(buf[8:], 0.6)
+	if !SharesStorage(whole, high) || !SharesStorage(low, whole) {
+		t.Errorf("expected maps over overlapping parts of a buffer to share storage")
+	}
+	if SharesStorage(low, high) {
+		t.Errorf("didn't expect maps over disjoint parts of a buffer to share storage")
+	}
+
+	alias.Release()
+	if SharesStorage(m, &alias) || SharesStorage(&alias, &alias) {
+		t.Errorf("didn't expect a released map to share storage")
+	}
+}
+
+func TestBucketLoads(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 10000; i++ {
+		m.Put(i, i)
+	}
+
+	loads := m.BucketLoads(16)
+	parts := m.Split(16)
+	total := 0
+	for b, n := range loads {
+		total += n
+		if n != parts[b].Size() {
+			t.Errorf("bucket %d holds %d entries, but split part holds %d", b, n, parts[b].Size())
+		}
+	}
+	if total != m.Size() {
+		t.Errorf("buckets hold %d entries, expected %d", total, m.Size())
+	}
+}
+
+func TestOccupancy(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 100; i++ {
+		m.Put(i, i)
+	}
+
+	slots, occupied := m.Occupancy()
+	if slots != len(m.data)/2 || len(occupied) != slots {
+		t.Errorf("unexpected slot count %d with %d flags", slots, len(occupied))
+	}
+	n := 0
+	for _, o := range occupied {
+		if o {
+			n++
+		}
+	}
+	if n != m.Size()-1 {
+		t.Errorf("got %d occupied slots, expected %d", n, m.Size()-1)
+	}
+}
+
+func TestLongestChain(t *testing.T) {
+	m := New(1024, 0.6)
+	m.Put(0, 0)
+	if home, keys := m.LongestChain(); home != NoHome || keys != nil {
+		t.Errorf("expected no chain for a map holding only the free key")
+	}
+
+	var i uint64
+	for i = 1; i < 300; i++ {
+		m.Put(i*0x9E3779B97F4A7C15, i)
+	}
+	want := map[uint64]bool{}
+	for i = 1; len(want) < 20; i++ {
+		if phiMix(i)&m.mask == 7 {
+			m.Put(i, i)
+			want[i] = true
+		}
+	}
+
+	home, keys := m.LongestChain()
+	if home != 7 {
+		t.Errorf("expected home slot 7, got %d", home)
+	}
+	for _, k := range keys {
+		if phiMix(k)&m.mask != home {
+			t.Errorf("key %d in the chain has another home", k)
+		}
+		delete(want, k)
+	}
+	if len(want) != 0 {
+		t.Errorf("keys %v missing from the chain", want)
+	}
+}
+
+func TestClustering(t *testing.T) {
+	m := New(1<<12, 0.9)
+	var i uint64
+	for i = 1; i < 3000; i++ {
+		m.Put(i*0x9E3779B97F4A7C15, i)
+	}
+	if c := m.Clustering(); c > 0.2 {
+		t.Errorf("clustering (%f) of well spread keys is too high", c)
+	}
+
+	// Delete and insert churn doesn't cluster the table.
+	for i = 1; i < 3000; i += 2 {
+		m.Del(i * 0x9E3779B97F4A7C15)
+		m.Put(i*0x9E3779B97F4A7C15+1, i)
+	}
+	if c := m.Clustering(); c > 0.2 {
+		t.Errorf("clustering (%f) after churn is too high", c)
+	}
+
+	// Pile keys onto few home slots.
+	for i = 1; m.Size() < 3600; i++ {
+		if phiMix(i)&m.mask < 8 {
+			m.Put(i, i)
+		}
+	}
+	c := m.Clustering()
+	if c < 0.5 {
+		t.Errorf("clustering (%f) of colliding keys is too low", c)
+	}
+	slots := len(m.data)
+	m.Reindex()
+	if len(m.data) != slots || math.Abs(m.Clustering()-c) > 1e-9 {
+		t.Errorf("clustering changed from %f to %f by rebuilding at the same size", c, m.Clustering())
+	}
+	if New(10, 0.6).Clustering() != 0 {
+		t.Errorf("expected no clustering for an empty map")
+	}
+}
+
+func TestIsAtHome(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 1000; i++ {
+		m.Put(i, i)
+	}
+
+	homes := 0
+	m.ItemsWithProbeDistance(func(k, _ uint64, dist int) bool {
+		home, found := m.IsAtHome(k)
+		if !found {
+			t.Errorf("expected key %d to be found", k)
+		}
+		if home != (dist == 0) {
+			t.Errorf("key %d at distance %d reported home=%v", k, dist, home)
+		}
+		if home {
+			homes++
+		}
+		return true
+	})
+	if homes == 0 || homes == m.Size() {
+		t.Errorf("unexpected number of keys at home: %d", homes)
+	}
+
+	if home, found := m.IsAtHome(5000); home || found {
+		t.Errorf("expected an absent key not to be found")
+	}
+	m.Del(0)
+	if home, found := m.IsAtHome(0); home || found {
+		t.Errorf("expected the absent free key not to be found")
+	}
+}
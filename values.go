@@ -0,0 +1,436 @@
+package intintmap
+
+import (
+	"math"
+	"math/rand"
+)
+
+// DecayValues right-shifts every value by shift bits, dividing it by
+// 2^shift, and removes the entries whose value decays to 0. This is the
+// aging step for decaying frequency counters; it runs in a single pass.
+func (m *Map) DecayValues(shift uint) {
+	m.update(func(_, v uint64) (uint64, bool) {
+		v >>= shift
+		return v, v == 0
+	})
+}
+
+// WeightedSample returns a key chosen with probability proportional to its
+// value, treating values as weights. It makes a single O(n) pass using the
+// A-Res weighted reservoir algorithm: each entry draws u uniformly from (0, 1)
+// and gets the priority u^(1/weight), and the entry with the largest priority
+// wins. Priorities are compared as log(u)/weight, and no cumulative array is
+// allocated. ok is false if the map is empty or every weight is 0.
+func (m *Map) WeightedSample(rng *rand.Rand) (key uint64, ok bool) {
+	best := math.Inf(-1)
+	m.each(func(k, w uint64) bool {
+		if w == 0 {
+			return true
+		}
+		u := rng.Float64()
+		for u == 0 {
+			u = rng.Float64()
+		}
+		if p := math.Log(u) / float64(w); p > best || !ok {
+			best, key, ok = p, k, true
+		}
+		return true
+	})
+	return key, ok
+}
+
+// ValueBlockSize is the number of slots in each block passed by ValueBlocks.
+const ValueBlockSize = 512
+
+// ValueBlocks hands the values to fn in contiguous blocks for bulk or
+// vectorized processing. Keys and values are interleaved in the table, so
+// each block is gathered into a scratch slice of up to ValueBlockSize values,
+// one per slot, with used[i] reporting whether slot i holds an entry; values
+// of free slots are 0 and must be skipped using used. The free key's value
+// comes first, in a block of its own. Changes fn makes to the values of used
+// slots are written back to the map; fn must not modify the map otherwise.
+//
+// The blocks are reused between calls to fn and only have the natural
+// 8-byte alignment of a []uint64; fn must not retain them.
+func (m *Map) ValueBlocks(fn func(vals []uint64, used []bool)) {
+	vals := make([]uint64, ValueBlockSize)
+	used := make([]bool, ValueBlockSize)
+
+	if m.hasFreeKey {
+		vals[0], used[0] = m.freeVal, true
+		fn(vals[:1], used[:1])
+		if m.hooked && vals[0] != m.freeVal {
+			m.onPut(0, FREE_KEY, m.freeVal, vals[0], true)
+		}
+		m.freeVal = vals[0]
+	}
+
+	data := m.data
+	for start := 0; start < len(data); start += 2 * ValueBlockSize {
+		n := 0
+		for i := start; i < len(data) && n < ValueBlockSize; i += 2 {
+			used[n] = data[i] != FREE_KEY
+			if used[n] {
+				vals[n] = data[i+1]
+			} else {
+				vals[n] = 0
+			}
+			n++
+		}
+
+		fn(vals[:n], used[:n])
+
+		for j := 0; j < n; j++ {
+			if !used[j] {
+				continue
+			}
+			i := start + 2*j
+			if m.hooked && vals[j] != data[i+1] {
+				m.onPut(uint64(i), data[i], data[i+1], vals[j], true)
+			}
+			data[i+1] = vals[j]
+		}
+	}
+}
+
+// DuplicateValueCounts returns a map from every value held by more than one
+// key, the free key included, to the number of keys holding it. It allocates
+// a counting map of up to Size() entries.
+func (m *Map) DuplicateValueCounts() *Map {
+	counts := m.newSized(m.Size())
+	m.each(func(_, v uint64) bool {
+		n, _ := counts.Get(v)
+		counts.Put(v, n+1)
+		return true
+	})
+	counts.update(func(_, n uint64) (uint64, bool) {
+		return n, n < 2
+	})
+	return counts
+}
+
+// DuplicateValues returns, for every value held by more than one key, the
+// keys holding it, the free key included, in unspecified order. Besides the
+// counting pass of DuplicateValueCounts it allocates a slice per duplicated
+// value, so its cost grows with the number of keys sharing values; prefer
+// DuplicateValueCounts when the keys aren't needed.
+func (m *Map) DuplicateValues() map[uint64][]uint64 {
+	counts := m.DuplicateValueCounts()
+	dups := make(map[uint64][]uint64, counts.Size())
+	m.each(func(k, v uint64) bool {
+		if n, ok := counts.Get(v); ok {
+			if dups[v] == nil {
+				dups[v] = make([]uint64, 0, n)
+			}
+			dups[v] = append(dups[v], k)
+		}
+		return true
+	})
+	return dups
+}
+
+// EvictToFit shrinks the map until MemoryBytes() is at most maxBytes,
+// evicting the entries with the lowest values to make room, and returns the
+// number evicted. The table shrinks to the largest power-of-two slot count
+// that fits; entries beyond its threshold are evicted. The victims are found
+// by quickselecting the value of the last one to go over a copy of the
+// values, O(n) on average, and then removed in one pass. The free key is
+// evicted by value like any other entry. Below 32 bytes the map is emptied
+// and left at its minimum size of 2 slots.
+func (m *Map) EvictToFit(maxBytes int) int {
+	if m.MemoryBytes() <= maxBytes {
+		return 0
+	}
+	slots := 2
+	for 16*slots*2 <= maxBytes {
+		slots *= 2
+	}
+	keep := int(math.Floor(float64(slots) * m.fillFactor))
+	if maxBytes < 32 {
+		keep = 0
+	}
+
+	evict := m.Size() - keep
+	if evict > 0 {
+		vals := make([]uint64, 0, m.Size())
+		m.each(func(_, v uint64) bool {
+			vals = append(vals, v)
+			return true
+		})
+		cut := selectNth(vals, evict-1)
+		below := 0 // victims with a value under cut, the rest have value cut
+		for _, v := range vals[:evict] {
+			if v < cut {
+				below++
+			}
+		}
+		ties := evict - below
+		m.update(func(_, v uint64) (uint64, bool) {
+			if v < cut {
+				return v, true
+			}
+			if v == cut && ties > 0 {
+				ties--
+				return v, true
+			}
+			return v, false
+		})
+	} else {
+		evict = 0
+	}
+	m.resize(slots)
+	return evict
+}
+
+// parallelReduceMin is the smallest table ParallelReduce splits across
+// goroutines; below it the overhead outweighs the gain.
+const parallelReduceMin = 1 << 14
+
+// ParallelReduce folds all values, the free key's included, with combine,
+// starting from identity. The backing array is split into workers ranges
+// reduced concurrently, and the partial results are combined in turn, so
+// combine must be associative and commutative and identity must be its
+// identity element; the order in which values are combined is unspecified.
+// Small maps and workers < 2 are reduced serially. The map must not be
+// modified during the call.
+func (m *Map) ParallelReduce(workers int, identity uint64, combine func(a, b uint64) uint64) uint64 {
+	acc := identity
+	if m.hasFreeKey {
+		acc = combine(acc, m.freeVal)
+	}
+
+	slots := len(m.data) / 2
+	if workers < 2 || slots < parallelReduceMin {
+		return combine(acc, m.reduceSlots(0, slots, identity, combine))
+	}
+	if workers > slots {
+		workers = slots
+	}
+
+	parts := make(chan uint64, workers)
+	for w := 0; w < workers; w++ {
+		go func(lo, hi int) {
+			parts <- m.reduceSlots(lo, hi, identity, combine)
+		}(w*slots/workers, (w+1)*slots/workers)
+	}
+	for w := 0; w < workers; w++ {
+		acc = combine(acc, <-parts)
+	}
+	return acc
+}
+
+// reduceSlots folds the values of the entries in slots [lo, hi).
+func (m *Map) reduceSlots(lo, hi int, acc uint64, combine func(a, b uint64) uint64) uint64 {
+	data := m.data
+	for i := 2 * lo; i < 2*hi; i += 2 {
+		if data[i] != FREE_KEY {
+			acc = combine(acc, data[i+1])
+		}
+	}
+	return acc
+}
+
+// IncrementWithLimit adds delta to the value of key, an absent key counting
+// as 0, unless the result would exceed limit. It returns the resulting
+// value and whether the increment was applied; a refused increment leaves
+// the map unchanged and returns the current value. If delta alone exceeds
+// limit every increment is refused, and an absent key is not inserted.
+func (m *Map) IncrementWithLimit(key, delta, limit uint64) (newVal uint64, allowed bool) {
+	if key == FREE_KEY {
+		var old uint64
+		if m.hasFreeKey {
+			old = m.freeVal
+		}
+		if old > limit || delta > limit-old {
+			return old, false
+		}
+		m.Put(FREE_KEY, old+delta)
+		return old + delta, true
+	}
+
+	ptr, ok := m.lookup(key)
+	if !ok {
+		if delta > limit {
+			return 0, false
+		}
+		m.putNew(ptr, key, delta)
+		return delta, true
+	}
+	old := m.data[ptr+1]
+	if old > limit || delta > limit-old {
+		return old, false
+	}
+	if m.hooked {
+		m.onPut(ptr, key, old, old+delta, true)
+	}
+	m.data[ptr+1] = old + delta
+	return old + delta, true
+}
+
+// WeightedMean returns the mean of the values, the free key's included,
+// with each value weighted by weightOf(key): sum(value*weight)/sum(weight),
+// accumulated in float64 in a single pass. It returns NaN if the weights sum
+// to 0, including for an empty map.
+func (m *Map) WeightedMean(weightOf func(key uint64) uint64) float64 {
+	var sum, total float64
+	m.each(func(k, v uint64) bool {
+		w := float64(weightOf(k))
+		sum += float64(v) * w
+		total += w
+		return true
+	})
+	if total == 0 {
+		return math.NaN()
+	}
+	return sum / total
+}
+
+// ClampValues limits every value, the free key's included, to [lo, hi] in
+// place: smaller values become lo and larger ones hi. Keys are untouched, so
+// Size is unchanged and nothing is rehashed. It panics if lo > hi.
+func (m *Map) ClampValues(lo, hi uint64) {
+	if lo > hi {
+		panic("Lo must not exceed hi")
+	}
+	m.update(func(_, v uint64) (uint64, bool) {
+		if v < lo {
+			return lo, false
+		}
+		if v > hi {
+			return hi, false
+		}
+		return v, false
+	})
+}
+
+// GroupKeysByValue returns a reverse index from every distinct value to the
+// keys holding it, the free key included, in unspecified order, built in a
+// single pass. Unlike DuplicateValues it includes values held by one key, so
+// its memory grows with the number of entries.
+func (m *Map) GroupKeysByValue() map[uint64][]uint64 {
+	groups := make(map[uint64][]uint64)
+	m.each(func(k, v uint64) bool {
+		groups[v] = append(groups[v], k)
+		return true
+	})
+	return groups
+}
+
+// WithRunningMinMax makes the map track the smallest and largest value on
+// every change so MinMax can usually answer in O(1). Deleting an entry
+// holding the current minimum or maximum, or overwriting it with a value
+// closer to the middle, only marks them stale; the next MinMax then rescans
+// the map in O(n). The cost is amortized over workloads that rarely remove
+// extremes.
+func WithRunningMinMax() Option {
+	return func(m *Map) {
+		m.hooked = true
+		m.ranged = true
+		m.rangeStale = true
+	}
+}
+
+// MinMax returns the smallest and largest value, the free key's included;
+// ok is false for an empty map. For maps created with WithRunningMinMax it
+// is O(1) unless an extreme was removed since the last call; otherwise it
+// scans the map.
+func (m *Map) MinMax() (lo, hi uint64, ok bool) {
+	if m.ranged && !m.rangeStale {
+		return m.minVal, m.maxVal, m.size > 0
+	}
+	lo = ^uint64(0)
+	m.each(func(_, v uint64) bool {
+		if v < lo {
+			lo = v
+		}
+		if v > hi {
+			hi = v
+		}
+		return true
+	})
+	if m.ranged {
+		m.minVal, m.maxVal, m.rangeStale = lo, hi, false
+	}
+	if m.size == 0 {
+		return 0, 0, false
+	}
+	return lo, hi, true
+}
+
+// UpdateMovingAverage folds sample into the exponentially weighted moving
+// average stored under key: alpha*sample + (1-alpha)*average, an absent key
+// starting at sample. Averages are stored as the IEEE 754 bits of a float64,
+// which keeps fractional precision across updates; read them back with
+// math.Float64frombits, and don't mix this with integer updates of the same
+// key. The key is looked up once. It panics unless alpha is in [0, 1].
+func (m *Map) UpdateMovingAverage(key, sample uint64, alpha float64) {
+	if !(alpha >= 0 && alpha <= 1) {
+		panic("Alpha must be in [0, 1]")
+	}
+	next := func(old uint64) uint64 {
+		avg := math.Float64frombits(old)
+		return math.Float64bits(alpha*float64(sample) + (1-alpha)*avg)
+	}
+
+	if key == FREE_KEY {
+		if m.hasFreeKey {
+			m.Put(FREE_KEY, next(m.freeVal))
+		} else {
+			m.Put(FREE_KEY, math.Float64bits(float64(sample)))
+		}
+		return
+	}
+
+	ptr, ok := m.lookup(key)
+	if !ok {
+		m.putNew(ptr, key, math.Float64bits(float64(sample)))
+		return
+	}
+	v := next(m.data[ptr+1])
+	if m.hooked {
+		m.onPut(ptr, key, m.data[ptr+1], v, true)
+	}
+	m.data[ptr+1] = v
+}
+
+// SumByPrefix returns a map from every distinct prefix of the keys, their
+// top prefixBits bits, to the sum of the values of the keys sharing it; sums
+// wrap on uint64 overflow. The result's keys are the prefixes shifted down,
+// key >> (64-prefixBits), so the free key counts towards prefix 0, with
+// prefixBits 0 summing everything under key 0 and 64 copying the map. It
+// panics if prefixBits exceeds 64.
+func (m *Map) SumByPrefix(prefixBits uint) *Map {
+	if prefixBits > 64 {
+		panic("PrefixBits must not exceed 64")
+	}
+	shift := 64 - prefixBits
+	sums := m.newSized(1)
+	m.each(func(k, v uint64) bool {
+		p := k >> shift
+		s, _ := sums.Get(p)
+		sums.Put(p, s+v)
+		return true
+	})
+	return sums
+}
+
+// ValueStdDev returns the mean and the population standard deviation of the
+// values, the free key's included, or (0, 0) for an empty map. It makes a
+// single pass with Welford's algorithm, which stays accurate for large
+// values where summing squares would cancel catastrophically. Divide the
+// variance by n-1 instead of n for the sample standard deviation.
+func (m *Map) ValueStdDev() (mean, stddev float64) {
+	var n, m2 float64
+	m.each(func(_, v uint64) bool {
+		n++
+		x := float64(v)
+		d := x - mean
+		mean += d / n
+		m2 += d * (x - mean)
+		return true
+	})
+	if n == 0 {
+		return 0, 0
+	}
+	return mean, math.Sqrt(m2 / n)
+}
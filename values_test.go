@@ -0,0 +1,455 @@
+package intintmap
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDecayValues(t *testing.T) {
+	m := New(10, 0.9)
+	var i uint64
+	for i = 0; i < 10000; i++ {
+		m.Put(i, i%8)
+	}
+
+	m.DecayValues(2)
+
+	if m.Size() != 10000/2 {
+		t.Errorf("size (%d) is not right, should be %d", m.Size(), 10000/2)
+	}
+	for i = 0; i < 10000; i++ {
+		v, ok := m.Get(i)
+		if i%8 < 4 {
+			if ok {
+				t.Errorf("expected key %d to decay away, got %d", i, v)
+			}
+		} else if !ok || v != (i%8)>>2 {
+			t.Errorf("expected %d as value for key %d, got %d", (i%8)>>2, i, v)
+		}
+	}
+	n := 0
+	for range m.Keys() {
+		n++
+	}
+	if n != m.Size() {
+		t.Errorf("iterated %d keys, expected %d", n, m.Size())
+	}
+
+	m.DecayValues(64)
+	if m.Size() != 0 {
+		t.Errorf("size (%d) is not right, should be 0", m.Size())
+	}
+}
+
+func TestWeightedSample(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	m := New(10, 0.6)
+	if _, ok := m.WeightedSample(rng); ok {
+		t.Errorf("didn't expect a sample from an empty map")
+	}
+	m.Put(1, 0)
+	m.Put(2, 0)
+	if _, ok := m.WeightedSample(rng); ok {
+		t.Errorf("didn't expect a sample when all weights are 0")
+	}
+
+	m.Put(0, 1)
+	m.Put(3, 3)
+	counts := map[uint64]int{}
+	for i := 0; i < 40000; i++ {
+		k, ok := m.WeightedSample(rng)
+		if !ok {
+			t.Fatalf("expected a sample")
+		}
+		counts[k]++
+	}
+	if counts[1] != 0 || counts[2] != 0 {
+		t.Errorf("sampled keys with weight 0: %v", counts)
+	}
+	if r := float64(counts[3]) / float64(counts[0]); r < 2.8 || r > 3.2 {
+		t.Errorf("sample ratio (%f) is not right, should be about 3", r)
+	}
+}
+
+func TestValueBlocks(t *testing.T) {
+	m := New(10, 0.6, WithRunningChecksum())
+	var i uint64
+	for i = 0; i < 5000; i++ {
+		m.Put(i, i)
+	}
+
+	var sum uint64
+	blocks := 0
+	m.ValueBlocks(func(vals []uint64, used []bool) {
+		blocks++
+		if len(vals) != len(used) || len(vals) > ValueBlockSize {
+			t.Errorf("unexpected block lengths %d and %d", len(vals), len(used))
+		}
+		for j, v := range vals {
+			if used[j] {
+				sum += v
+				vals[j] = v * 2
+			} else if v != 0 {
+				t.Errorf("expected 0 for a free slot, got %d", v)
+			}
+		}
+	})
+	if sum != 5000*4999/2 {
+		t.Errorf("sum (%d) is not right, should be %d", sum, 5000*4999/2)
+	}
+	if blocks < 2 {
+		t.Errorf("expected the free key and the table in separate blocks")
+	}
+	for i = 0; i < 5000; i++ {
+		if v, ok := m.Get(i); !ok || v != i*2 {
+			t.Errorf("expected %d as value for key %d, got %d", i*2, i, v)
+		}
+	}
+	if m.RunningChecksum() != m.Checksum() {
+		t.Errorf("running checksum diverged after ValueBlocks")
+	}
+}
+
+func TestDuplicateValues(t *testing.T) {
+	m := New(10, 0.6)
+	m.Put(0, 7)
+	m.Put(1, 7)
+	m.Put(2, 7)
+	m.Put(3, 8)
+	m.Put(4, 9)
+	m.Put(5, 9)
+
+	counts := m.DuplicateValueCounts()
+	if counts.Size() != 2 {
+		t.Errorf("got %d duplicated values, expected 2", counts.Size())
+	}
+	if n, _ := counts.Get(7); n != 3 {
+		t.Errorf("expected value 7 held 3 times, got %d", n)
+	}
+
+	dups := m.DuplicateValues()
+	if len(dups) != 2 || len(dups[7]) != 3 || len(dups[9]) != 2 {
+		t.Errorf("unexpected duplicates %v", dups)
+	}
+	if _, ok := dups[8]; ok {
+		t.Errorf("didn't expect unique value 8")
+	}
+}
+
+func TestEvictToFit(t *testing.T) {
+	m := New(10, 0.5, WithRunningChecksum())
+	var i uint64
+	for i = 0; i < 1000; i++ {
+		m.Put(i, i%100)
+	}
+	if m.EvictToFit(m.MemoryBytes()) != 0 {
+		t.Errorf("didn't expect evictions from a map that fits")
+	}
+
+	evicted := m.EvictToFit(8 * 1024)
+	if m.MemoryBytes() > 8*1024 {
+		t.Errorf("memory (%d) exceeds the budget", m.MemoryBytes())
+	}
+	if evicted+m.Size() != 1000 {
+		t.Errorf("evicted %d entries but %d remain, expected 1000 in total", evicted, m.Size())
+	}
+	if m.Size() != 256 {
+		t.Errorf("size (%d) is not right, should be 256", m.Size())
+	}
+	var lowest uint64 = 100
+	for kv := range m.Items() {
+		if kv[1] < lowest {
+			lowest = kv[1]
+		}
+		if kv[1] != kv[0]%100 {
+			t.Errorf("unexpected value %d for key %d", kv[1], kv[0])
+		}
+	}
+	if lowest < 74 {
+		t.Errorf("expected the lowest values to be evicted, %d remains", lowest)
+	}
+	if m.RunningChecksum() != m.Checksum() {
+		t.Errorf("running checksum diverged after EvictToFit")
+	}
+
+	m.EvictToFit(0)
+	if m.Size() != 0 {
+		t.Errorf("size (%d) is not right, should be 0", m.Size())
+	}
+}
+
+func TestParallelReduce(t *testing.T) {
+	add := func(a, b uint64) uint64 { return a + b }
+	larger := func(a, b uint64) uint64 {
+		if a > b {
+			return a
+		}
+		return b
+	}
+
+	for _, n := range []uint64{10, 100000} {
+		m := New(10, 0.6)
+		var i, sum uint64
+		for i = 0; i < n; i++ {
+			m.Put(i, i+1)
+			sum += i + 1
+		}
+		for _, workers := range []int{1, 3, 8} {
+			if got := m.ParallelReduce(workers, 0, add); got != sum {
+				t.Errorf("sum with %d workers (%d) is not right, should be %d", workers, got, sum)
+			}
+			if got := m.ParallelReduce(workers, 0, larger); got != n {
+				t.Errorf("max with %d workers (%d) is not right, should be %d", workers, got, n)
+			}
+		}
+	}
+}
+
+func TestIncrementWithLimit(t *testing.T) {
+	m := New(10, 0.6, WithRunningChecksum())
+	for _, key := range []uint64{0, 42} {
+		for i := uint64(1); i <= 3; i++ {
+			if v, ok := m.IncrementWithLimit(key, 3, 10); !ok || v != 3*i {
+				t.Errorf("expected increment %d of key %d to give %d, got %d", i, key, 3*i, v)
+			}
+		}
+		if v, ok := m.IncrementWithLimit(key, 3, 10); ok || v != 9 {
+			t.Errorf("expected increment of key %d past the limit to be refused at 9, got %d", key, v)
+		}
+		if v, ok := m.IncrementWithLimit(key, 1, 10); !ok || v != 10 {
+			t.Errorf("expected increment of key %d up to the limit, got %d", key, v)
+		}
+	}
+
+	if _, ok := m.IncrementWithLimit(7, 11, 10); ok {
+		t.Errorf("expected a delta above the limit to be refused")
+	}
+	if _, ok := m.Get(7); ok {
+		t.Errorf("didn't expect a refused increment to insert the key")
+	}
+	if m.IncrementWithLimit(42, ^uint64(0), ^uint64(0)); m.Size() != 2 {
+		t.Errorf("size (%d) is not right, should be 2", m.Size())
+	}
+	if v, _ := m.Get(42); v != 10 {
+		t.Errorf("expected an overflowing increment to be refused, got %d", v)
+	}
+	if m.RunningChecksum() != m.Checksum() {
+		t.Errorf("running checksum diverged after IncrementWithLimit")
+	}
+}
+
+func TestWeightedMean(t *testing.T) {
+	m := New(10, 0.6)
+	if !math.IsNaN(m.WeightedMean(func(uint64) uint64 { return 1 })) {
+		t.Errorf("expected NaN for an empty map")
+	}
+	m.Put(0, 10)
+	m.Put(1, 20)
+	m.Put(2, 40)
+
+	mean := m.WeightedMean(func(k uint64) uint64 { return k + 1 })
+	if want := (10*1 + 20*2 + 40*3) / 6.0; mean != want {
+		t.Errorf("mean (%f) is not right, should be %f", mean, want)
+	}
+	if !math.IsNaN(m.WeightedMean(func(uint64) uint64 { return 0 })) {
+		t.Errorf("expected NaN for zero total weight")
+	}
+}
+
+func TestClampValues(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 100; i++ {
+		m.Put(i, i)
+	}
+
+	m.ClampValues(10, 20)
+	if m.Size() != 100 {
+		t.Errorf("size (%d) is not right, should be 100", m.Size())
+	}
+	for i = 0; i < 100; i++ {
+		want := i
+		if want < 10 {
+			want = 10
+		} else if want > 20 {
+			want = 20
+		}
+		if v, ok := m.Get(i); !ok || v != want {
+			t.Errorf("expected %d as value for key %d, got %d", want, i, v)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for lo > hi")
+		}
+	}()
+	m.ClampValues(2, 1)
+}
+
+func TestGroupKeysByValue(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 30; i++ {
+		m.Put(i, i%3)
+	}
+
+	groups := m.GroupKeysByValue()
+	if len(groups) != 3 {
+		t.Errorf("got %d groups, expected 3", len(groups))
+	}
+	for v, keys := range groups {
+		if len(keys) != 10 {
+			t.Errorf("got %d keys with value %d, expected 10", len(keys), v)
+		}
+		for _, k := range keys {
+			if k%3 != v {
+				t.Errorf("key %d doesn't hold value %d", k, v)
+			}
+		}
+	}
+}
+
+func TestRunningMinMax(t *testing.T) {
+	m := New(10, 0.6, WithRunningMinMax())
+	if _, _, ok := m.MinMax(); ok {
+		t.Errorf("expected no min/max for an empty map")
+	}
+
+	check := func(wantMin, wantMax uint64) {
+		t.Helper()
+		lo, hi, ok := m.MinMax()
+		if !ok || lo != wantMin || hi != wantMax {
+			t.Errorf("got min/max %d/%d (%v), expected %d/%d", lo, hi, ok, wantMin, wantMax)
+		}
+		plain := New(10, 0.6)
+		m.each(func(k, v uint64) bool {
+			plain.Put(k, v)
+			return true
+		})
+		if plo, phi, _ := plain.MinMax(); plo != lo || phi != hi {
+			t.Errorf("running min/max %d/%d differ from scanned %d/%d", lo, hi, plo, phi)
+		}
+	}
+
+	var i uint64
+	for i = 1; i <= 100; i++ {
+		m.Put(i, i*10)
+	}
+	check(10, 1000)
+
+	m.Put(FREE_KEY, 5)
+	check(5, 1000)
+	m.Del(FREE_KEY) // deleting the minimum
+	check(10, 1000)
+	m.Del(100) // deleting the maximum
+	check(10, 990)
+	m.Put(1, 500) // the minimum moves inwards
+	check(20, 990)
+	m.Put(2, 2000)
+	check(30, 2000)
+
+	for i = 1; i < 100; i++ {
+		m.Del(i)
+	}
+	if _, _, ok := m.MinMax(); ok {
+		t.Errorf("expected no min/max after deleting everything")
+	}
+	m.Put(7, 70)
+	check(70, 70)
+}
+
+func TestUpdateMovingAverage(t *testing.T) {
+	m := New(10, 0.6)
+	avg := func(k uint64) float64 {
+		v, _ := m.Get(k)
+		return math.Float64frombits(v)
+	}
+
+	var i uint64
+	for i = 0; i < 100; i++ {
+		m.UpdateMovingAverage(i, 10, 0.5)
+	}
+	for i = 0; i < 100; i++ {
+		if a := avg(i); a != 10 {
+			t.Errorf("expected average %v for key %d, got %v", 10.0, i, a)
+		}
+	}
+	for i = 0; i < 100; i++ {
+		m.UpdateMovingAverage(i, 20, 0.5)
+		m.UpdateMovingAverage(i, 40, 0.25)
+	}
+	for i = 0; i < 100; i++ {
+		if a := avg(i); a != 21.25 { // 0.25*40 + 0.75*(0.5*20 + 0.5*10)
+			t.Errorf("expected average %v for key %d, got %v", 21.25, i, a)
+		}
+	}
+	if m.Size() != 100 {
+		t.Errorf("size (%d) is not right, should be %d", m.Size(), 100)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for alpha out of [0, 1]")
+		}
+	}()
+	m.UpdateMovingAverage(1, 1, 1.5)
+}
+
+func TestSumByPrefix(t *testing.T) {
+	m := New(10, 0.6)
+	var i uint64
+	for i = 0; i < 300; i++ {
+		m.Put(i%3<<60|i, i) // tenant in the top 4 bits
+	}
+
+	sums := m.SumByPrefix(4)
+	if sums.Size() != 3 {
+		t.Errorf("size (%d) is not right, should be %d", sums.Size(), 3)
+	}
+	for p := uint64(0); p < 3; p++ {
+		var want uint64
+		for i = p; i < 300; i += 3 {
+			want += i
+		}
+		if v, ok := sums.Get(p); !ok || v != want {
+			t.Errorf("expected %d as value for key %d, got %d", want, p, v)
+		}
+	}
+
+	if all := m.SumByPrefix(0); all.Size() != 1 {
+		t.Errorf("size (%d) is not right, should be %d", all.Size(), 1)
+	} else if v, _ := all.Get(0); v != 299*300/2 {
+		t.Errorf("expected %d as value for key %d, got %d", 299*300/2, 0, v)
+	}
+	if same := m.SumByPrefix(64); same.Size() != m.Size() || same.Checksum() != m.Checksum() {
+		t.Errorf("expected 64 prefix bits to copy the map")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic for more than 64 prefix bits")
+		}
+	}()
+	m.SumByPrefix(65)
+}
+
+func TestValueStdDev(t *testing.T) {
+	m := New(10, 0.6)
+	if mean, sd := m.ValueStdDev(); mean != 0 || sd != 0 {
+		t.Errorf("got %v, %v for an empty map, expected 0, 0", mean, sd)
+	}
+
+	base := uint64(1) << 40 // large values ruin the naive sum of squares
+	for i, v := range []uint64{2, 4, 4, 4, 5, 5, 7, 9} {
+		m.Put(uint64(i), base+v) // the free key included
+	}
+	mean, sd := m.ValueStdDev()
+	if math.Abs(mean-(float64(base)+5)) > 1e-3 {
+		t.Errorf("got mean %v, expected %v", mean, float64(base)+5)
+	}
+	if math.Abs(sd-2) > 1e-3 {
+		t.Errorf("got standard deviation %v, expected 2", sd)
+	}
+}